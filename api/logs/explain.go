@@ -0,0 +1,71 @@
+package logs
+
+// SearchExplanation describes how a search would be routed
+// without running it.
+type SearchExplanation struct {
+	// Backends explains the routing decision for every loaded backend
+	Backends []BackendExplanation `json:"backends"`
+
+	// Run is the list of backends the search would run on
+	Run []string `json:"run"`
+}
+
+// BackendExplanation describes the routing decision for a single backend.
+type BackendExplanation struct {
+	Backend string `json:"backend"`
+	Type    string `json:"type"`
+
+	// Capabilities are the parts of the search the backend applies itself
+	Capabilities Capabilities `json:"capabilities"`
+
+	// Routes explains why each of the backend's routes did or did not match
+	Routes []RouteExplanation `json:"routes,omitempty"`
+
+	// Route is the route that matched the search
+	Route *SearchRoute `json:"route,omitempty"`
+
+	// IsAdditive is set when the matched route is additive
+	IsAdditive bool `json:"additive,omitempty"`
+
+	// Run is set when the search would run on the backend
+	Run bool `json:"run"`
+
+	// Discarded is set when the results of the backend would be discarded
+	// in favour of a backend with an additive route.
+	Discarded bool `json:"discarded,omitempty"`
+
+	// Reason explains why the search would not run on the backend
+	Reason string `json:"reason,omitempty"`
+
+	// Rewrites are the searches the route's rewrite maps the search into
+	Rewrites []SearchParams `json:"rewrites,omitempty"`
+
+	// Queries are the rendered queries of templated backends,
+	// one for every search run on the backend.
+	Queries    []string `json:"queries,omitempty"`
+	QueryError string   `json:"queryError,omitempty"`
+}
+
+// RouteExplanation describes whether a single route matched the search.
+type RouteExplanation struct {
+	Route   SearchRoute `json:"route"`
+	Matched bool        `json:"matched"`
+
+	// Reason is the condition of the route that failed
+	Reason string `json:"reason,omitempty"`
+}
+
+// Explain explains the matching of every route against the search params.
+func (t Routes) Explain(q *SearchParams) []RouteExplanation {
+	explanations := make([]RouteExplanation, 0, len(t))
+	for _, route := range t {
+		matched, reason := route.Explain(q)
+		explanations = append(explanations, RouteExplanation{
+			Route:   route,
+			Matched: matched,
+			Reason:  reason,
+		})
+	}
+
+	return explanations
+}
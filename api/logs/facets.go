@@ -0,0 +1,91 @@
+package logs
+
+import "sort"
+
+// DefaultFacetLimit is the number of values returned per facet when the search doesn't set one.
+const DefaultFacetLimit = 10
+
+// Facets holds the most frequent values of the labels of the matched results, keyed by label.
+type Facets map[string][]FacetValue
+
+// FacetValue is a value of a label and the number of matched results with it.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// GetFacetLimit returns the number of values to return per facet.
+func (p SearchParams) GetFacetLimit() int {
+	if p.FacetLimit <= 0 {
+		return DefaultFacetLimit
+	}
+
+	return p.FacetLimit
+}
+
+// CountFacets counts the values of the labels of the results
+// and keeps the limit most frequent values of each label.
+func CountFacets(labels []string, limit int, results []Result) Facets {
+	counts := make(map[string]map[string]int64, len(labels))
+	for _, label := range labels {
+		counts[label] = make(map[string]int64)
+	}
+
+	for _, r := range results {
+		for _, label := range labels {
+			if value, ok := r.Labels[label]; ok {
+				counts[label][value]++
+			}
+		}
+	}
+
+	return topFacets(counts, limit)
+}
+
+// MergeFacets adds up the counts of the facets of multiple backends
+// and keeps the limit most frequent values of each label.
+func MergeFacets(limit int, facets ...Facets) Facets {
+	var counts map[string]map[string]int64
+	for _, f := range facets {
+		for label, values := range f {
+			if counts == nil {
+				counts = make(map[string]map[string]int64)
+			}
+			if counts[label] == nil {
+				counts[label] = make(map[string]int64)
+			}
+			for _, v := range values {
+				counts[label][v.Value] += v.Count
+			}
+		}
+	}
+
+	if counts == nil {
+		return nil
+	}
+	return topFacets(counts, limit)
+}
+
+// topFacets orders the values of every label by their count, then by value,
+// and keeps the limit first ones.
+func topFacets(counts map[string]map[string]int64, limit int) Facets {
+	facets := make(Facets, len(counts))
+	for label, values := range counts {
+		top := make([]FacetValue, 0, len(values))
+		for value, count := range values {
+			top = append(top, FacetValue{Value: value, Count: count})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Count != top[j].Count {
+				return top[i].Count > top[j].Count
+			}
+			return top[i].Value < top[j].Value
+		})
+		if limit > 0 && len(top) > limit {
+			top = top[:limit]
+		}
+		facets[label] = top
+	}
+
+	return facets
+}
@@ -0,0 +1,41 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountFacets(t *testing.T) {
+	results := []Result{
+		{Labels: map[string]string{"namespace": "default", "level": "error"}},
+		{Labels: map[string]string{"namespace": "default", "level": "info"}},
+		{Labels: map[string]string{"namespace": "monitoring", "level": "error"}},
+		{Labels: map[string]string{"namespace": "default"}},
+		{Labels: map[string]string{"namespace": "kube-system", "level": "warn"}},
+	}
+
+	got := CountFacets([]string{"namespace", "level", "pod"}, 2, results)
+	want := Facets{
+		"namespace": {{Value: "default", Count: 3}, {Value: "kube-system", Count: 1}},
+		"level":     {{Value: "error", Count: 2}, {Value: "info", Count: 1}},
+		"pod":       {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CountFacets() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeFacets(t *testing.T) {
+	es := Facets{"level": {{Value: "error", Count: 5}, {Value: "info", Count: 2}}}
+	k8s := Facets{"level": {{Value: "info", Count: 4}, {Value: "debug", Count: 1}}}
+
+	got := MergeFacets(2, es, nil, k8s)
+	want := Facets{"level": {{Value: "info", Count: 6}, {Value: "error", Count: 5}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeFacets() = %v, want %v", got, want)
+	}
+
+	if got := MergeFacets(2, nil, nil); got != nil {
+		t.Errorf("MergeFacets() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,191 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	durationUtil "github.com/flanksource/commons/duration"
+)
+
+// DefaultHistogramBuckets is the number of buckets the time range of a histogram
+// is split into when no interval is given.
+const DefaultHistogramBuckets = 100
+
+// MaxHistogramBuckets is the maximum number of buckets of a histogram.
+const MaxHistogramBuckets = 2000
+
+// histogramIntervals are the intervals picked from when no interval is given.
+var histogramIntervals = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// HistogramParams are the params of a count of the results of a search over time.
+type HistogramParams struct {
+	SearchParams
+
+	// Interval is the width of the buckets, e.g. "1m", "1h".
+	// Defaults to the interval that splits the time range of the search in about 100 buckets.
+	Interval string `json:"interval,omitempty"`
+
+	// GroupBy is the label the counts are broken down by, e.g. "namespace" or "level".
+	// Defaults to the backend of the results.
+	GroupBy string `json:"groupBy,omitempty"`
+}
+
+// SetDefaults sets the default values of the params if they are not set.
+func (p *HistogramParams) SetDefaults() {
+	p.SearchParams.SetDefaults()
+
+	if p.GroupBy == "" {
+		p.GroupBy = LabelBackend
+	}
+}
+
+// GetInterval returns the width of the buckets.
+func (p *HistogramParams) GetInterval() (time.Duration, error) {
+	end := time.Now()
+	if e := p.GetEnd(); e != nil {
+		end = *e
+	}
+
+	var span time.Duration
+	if start := p.GetStart(); start != nil {
+		span = end.Sub(*start)
+	}
+
+	if p.Interval == "" {
+		for _, interval := range histogramIntervals {
+			if span/interval <= DefaultHistogramBuckets {
+				return interval, nil
+			}
+		}
+		return histogramIntervals[len(histogramIntervals)-1], nil
+	}
+
+	d, err := durationUtil.ParseDuration(p.Interval)
+	interval := time.Duration(d)
+	if err != nil || interval < time.Millisecond {
+		return 0, fmt.Errorf("invalid histogram interval %q", p.Interval)
+	}
+	if span/interval > MaxHistogramBuckets {
+		return 0, fmt.Errorf("histogram interval %q is too small for the time range: more than %d buckets", p.Interval, MaxHistogramBuckets)
+	}
+
+	return interval, nil
+}
+
+// Histogram is the count of the results of a search over time.
+type Histogram struct {
+	// Interval is the width of the buckets
+	Interval string `json:"interval"`
+	// GroupBy is the label the counts are broken down by
+	GroupBy string            `json:"groupBy"`
+	Series  []HistogramSeries `json:"series"`
+	// Backends is the status of every backend that was counted
+	Backends []BackendStatus `json:"backends,omitempty"`
+}
+
+// HasErrors returns true if any of the counted backends failed.
+func (t Histogram) HasErrors() bool {
+	for _, b := range t.Backends {
+		if b.Error != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HistogramSeries holds the counts of a group, ordered by time.
+// Buckets without results are left out.
+type HistogramSeries struct {
+	// Group is the value of the label the counts are broken down by
+	Group   string            `json:"group"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+type HistogramBucket struct {
+	// Time is the start of the bucket as a RFC3339 timestamp
+	Time  string `json:"timestamp"`
+	Count int64  `json:"count"`
+}
+
+// +kubebuilder:object:generate=false
+// Histogrammer is implemented by the backends that count the results of a search over time themselves.
+//
+// The results of the backends that don't implement it are counted in memory.
+type Histogrammer interface {
+	// Histogram counts the results of the search in buckets of the given interval,
+	// broken down by the GroupBy label of the params.
+	Histogram(ctx context.Context, q *HistogramParams, interval time.Duration) ([]HistogramSeries, error)
+}
+
+// BucketStart returns the start of the bucket of the given interval the time falls in.
+// Buckets are aligned to the unix epoch, like the histograms of the backends.
+func BucketStart(t time.Time, interval time.Duration) time.Time {
+	ms := t.UnixMilli()
+	return time.UnixMilli(ms - ms%interval.Milliseconds()).UTC()
+}
+
+// HistogramCounter adds up counts per group and bucket.
+type HistogramCounter struct {
+	interval time.Duration
+	counts   map[string]map[time.Time]int64
+}
+
+func NewHistogramCounter(interval time.Duration) *HistogramCounter {
+	return &HistogramCounter{interval: interval, counts: make(map[string]map[time.Time]int64)}
+}
+
+// Add adds the count to the bucket the time falls in.
+func (c *HistogramCounter) Add(group string, t time.Time, count int64) {
+	if c.counts[group] == nil {
+		c.counts[group] = make(map[time.Time]int64)
+	}
+	c.counts[group][BucketStart(t, c.interval)] += count
+}
+
+// AddResults counts the results by the value of their groupBy label.
+// Results without a timestamp can't be placed in a bucket and are left out.
+func (c *HistogramCounter) AddResults(groupBy string, results ...Result) {
+	for _, r := range results {
+		if t, ok := r.GetTime(); ok {
+			c.Add(r.Labels[groupBy], t, 1)
+		}
+	}
+}
+
+// AddSeries adds up the counts of the series.
+func (c *HistogramCounter) AddSeries(series ...HistogramSeries) {
+	for _, s := range series {
+		for _, b := range s.Buckets {
+			if t, ok := ParseTimestamp(b.Time); ok {
+				c.Add(s.Group, t, b.Count)
+			}
+		}
+	}
+}
+
+// Series returns the counts of every group, ordered by group and time.
+func (c *HistogramCounter) Series() []HistogramSeries {
+	series := make([]HistogramSeries, 0, len(c.counts))
+	for group, counts := range c.counts {
+		s := HistogramSeries{Group: group, Buckets: make([]HistogramBucket, 0, len(counts))}
+		times := make([]time.Time, 0, len(counts))
+		for t := range counts {
+			times = append(times, t)
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		for _, t := range times {
+			s.Buckets = append(s.Buckets, HistogramBucket{Time: t.Format(time.RFC3339Nano), Count: counts[t]})
+		}
+		series = append(series, s)
+	}
+
+	sort.Slice(series, func(i, j int) bool { return series[i].Group < series[j].Group })
+	return series
+}
@@ -0,0 +1,55 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistogramParamsGetInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  HistogramParams
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default for an hour", params: HistogramParams{SearchParams: SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z"}}, want: time.Minute},
+		{name: "default for a week", params: HistogramParams{SearchParams: SearchParams{Start: "2023-03-02T12:00:00Z", End: "2023-03-09T12:00:00Z"}}, want: 3 * time.Hour},
+		{name: "given", params: HistogramParams{SearchParams: SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z"}, Interval: "5s"}, want: 5 * time.Second},
+		{name: "days", params: HistogramParams{SearchParams: SearchParams{Start: "2023-03-02T12:00:00Z", End: "2023-03-09T12:00:00Z"}, Interval: "1d"}, want: 24 * time.Hour},
+		{name: "invalid", params: HistogramParams{Interval: "5 minutes"}, wantErr: true},
+		{name: "too many buckets", params: HistogramParams{SearchParams: SearchParams{Start: "2023-03-02T12:00:00Z", End: "2023-03-09T12:00:00Z"}, Interval: "1s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.params.GetInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramCounter(t *testing.T) {
+	counter := NewHistogramCounter(time.Minute)
+	counter.AddResults("level",
+		Result{Time: "2023-03-09T12:00:10Z", Labels: map[string]string{"level": "error"}},
+		Result{Time: "2023-03-09T12:00:50Z", Labels: map[string]string{"level": "error"}},
+		Result{Time: "2023-03-09 12:01:05.000", Labels: map[string]string{"level": "error"}},
+		Result{Time: "2023-03-09T14:00:20+02:00", Labels: map[string]string{"level": "info"}},
+		Result{Labels: map[string]string{"level": "info"}},
+	)
+	counter.AddSeries(HistogramSeries{Group: "info", Buckets: []HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 5}}})
+
+	want := []HistogramSeries{
+		{Group: "error", Buckets: []HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 2}, {Time: "2023-03-09T12:01:00Z", Count: 1}}},
+		{Group: "info", Buckets: []HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 6}}},
+	}
+	if got := counter.Series(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Series() = %v, want %v", got, want)
+	}
+}
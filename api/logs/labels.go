@@ -0,0 +1,158 @@
+package logs
+
+import (
+	"context"
+	"sort"
+)
+
+// Canonical label keys.
+//
+// Every backend returns these keys for the same concepts
+// and interprets them the same way in the labels of a search.
+const (
+	LabelPod       = "pod"
+	LabelNamespace = "namespace"
+	LabelContainer = "container"
+	LabelNode      = "node"
+	LabelHost      = "host"
+	LabelLevel     = "level"
+)
+
+// CanonicalLabels is the list of the canonical label keys.
+var CanonicalLabels = []string{LabelPod, LabelNamespace, LabelContainer, LabelNode, LabelHost, LabelLevel, LabelBackend}
+
+// DefaultLabelMappings are the label mappings of each backend type
+// that can be overridden with the labelMapping of a backend.
+var DefaultLabelMappings = map[string]LabelMapping{
+	BackendTypeKubernetes: {
+		LabelContainer: "containerName",
+		LabelNode:      "nodeName",
+	},
+	BackendTypeElasticSearch: elasticCommonSchema,
+	BackendTypeOpenSearch:    elasticCommonSchema,
+}
+
+// elasticCommonSchema maps the canonical labels to the fields
+// of the Elastic Common Schema used by filebeat and fluent-bit.
+var elasticCommonSchema = LabelMapping{
+	LabelPod:       "kubernetes.pod.name",
+	LabelNamespace: "kubernetes.namespace",
+	LabelContainer: "kubernetes.container.name",
+	LabelNode:      "kubernetes.node.name",
+	LabelHost:      "host.name",
+	LabelLevel:     "log.level",
+}
+
+// LabelMapping maps canonical label keys to the native fields of a backend.
+type LabelMapping map[string]string
+
+// NewLabelMapping returns the default label mapping of the backend type
+// with the given overrides applied. An override with an empty field
+// removes the default mapping of the canonical label.
+func NewLabelMapping(backendType string, overrides map[string]string) LabelMapping {
+	mapping := make(LabelMapping, len(DefaultLabelMappings[backendType])+len(overrides))
+	for k, v := range DefaultLabelMappings[backendType] {
+		mapping[k] = v
+	}
+
+	for k, v := range overrides {
+		if v == "" {
+			delete(mapping, k)
+			continue
+		}
+		mapping[k] = v
+	}
+
+	return mapping
+}
+
+// Native returns the native field of the label key.
+func (t LabelMapping) Native(key string) string {
+	if field, ok := t[key]; ok {
+		return field
+	}
+
+	return key
+}
+
+// Canonical returns the canonical label key of the native field.
+// When several keys are mapped to the field, the first of them in alphabetical order is returned.
+func (t LabelMapping) Canonical(field string) string {
+	canonical, ok := "", false
+	for k, v := range t {
+		if v == field && (!ok || k < canonical) {
+			canonical, ok = k, true
+		}
+	}
+
+	if !ok {
+		return field
+	}
+	return canonical
+}
+
+// ToNative returns a copy of the labels with the canonical keys
+// replaced by the native fields of the backend.
+func (t LabelMapping) ToNative(labels map[string]string) map[string]string {
+	return t.rename(labels, t.Native)
+}
+
+// ToCanonical returns a copy of the labels with the native fields
+// of the backend replaced by the canonical keys.
+func (t LabelMapping) ToCanonical(labels map[string]string) map[string]string {
+	return t.rename(labels, t.Canonical)
+}
+
+func (t LabelMapping) rename(labels map[string]string, fn func(string) string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	renamed := make(map[string]string, len(labels))
+	for k, v := range labels {
+		renamed[fn(k)] = v
+	}
+
+	return renamed
+}
+
+// +kubebuilder:object:generate=false
+// LabelDiscoverer is implemented by the backends that can list the labels
+// their results can be searched by and the values seen for them.
+type LabelDiscoverer interface {
+	// LabelKeys returns the canonical keys of the labels of the backend.
+	LabelKeys(ctx context.Context) ([]string, error)
+
+	// LabelValues returns the values seen for the label.
+	LabelValues(ctx context.Context, label string) ([]string, error)
+}
+
+// DiscoveredLabels lists the label keys, or the values of a label, of the backends.
+type DiscoveredLabels struct {
+	// Label is the label whose values are listed. It is empty when the keys are listed
+	Label string `json:"label,omitempty"`
+
+	// Values are the keys, or the values, of every backend merged and sorted
+	Values []string `json:"values"`
+
+	// Backends holds what was discovered on each backend
+	Backends []BackendLabels `json:"backends"`
+}
+
+// BackendLabels lists the label keys, or the values of a label, of a single backend.
+type BackendLabels struct {
+	Backend string   `json:"backend"`
+	Type    string   `json:"type"`
+	Values  []string `json:"values,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// LabelKeys returns the keys of the labels attached to every result of the backend, sorted.
+func (c CommonBackend) LabelKeys() []string {
+	keys := make([]string, 0, len(c.Labels))
+	for k := range c.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,60 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelMapping(t *testing.T) {
+	mapping := NewLabelMapping(BackendTypeElasticSearch, map[string]string{
+		LabelHost: "",
+		LabelPod:  "k8s.pod",
+		"app":     "labels.app",
+	})
+
+	tests := []struct {
+		name   string
+		fn     func(map[string]string) map[string]string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "to native",
+			fn:     mapping.ToNative,
+			labels: map[string]string{LabelPod: "nginx", LabelNamespace: "default", LabelHost: "node-1", "app": "web", "zone": "a"},
+			want:   map[string]string{"k8s.pod": "nginx", "kubernetes.namespace": "default", LabelHost: "node-1", "labels.app": "web", "zone": "a"},
+		},
+		{
+			name:   "to canonical",
+			fn:     mapping.ToCanonical,
+			labels: map[string]string{"k8s.pod": "nginx", "kubernetes.container.name": "proxy", "host.name": "node-1", "labels.app": "web"},
+			want:   map[string]string{LabelPod: "nginx", LabelContainer: "proxy", "host.name": "node-1", "app": "web"},
+		},
+		{
+			name:   "nil labels",
+			fn:     mapping.ToCanonical,
+			labels: nil,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The node and the host are both mapped to the field of the node
+	duplicated := NewLabelMapping(BackendTypeElasticSearch, map[string]string{LabelHost: "kubernetes.node.name"})
+	for i := 0; i < 20; i++ {
+		if got := duplicated.Canonical("kubernetes.node.name"); got != LabelHost {
+			t.Fatalf("Canonical() = %q, want %q", got, LabelHost)
+		}
+	}
+
+	if got := NewLabelMapping(BackendTypeFile, nil); len(got) != 0 {
+		t.Errorf("NewLabelMapping() = %v, want an empty mapping", got)
+	}
+}
@@ -2,7 +2,9 @@ package logs
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,6 +15,9 @@ import (
 
 var GlobalBackends []SearchBackend
 
+// LabelBackend is the label, attached to every result, that holds the name of the backend it came from.
+const LabelBackend = "backend"
+
 // SearchConfig refers to the main configuration
 // that consists of configuration for a list of backends.
 type SearchConfig struct {
@@ -23,6 +28,14 @@ type SearchConfig struct {
 
 // +kubebuilder:object:generate=true
 type SearchBackendConfig struct {
+	// Name uniquely identifies the backend. It is used to select backends in a search
+	// and is attached to every result as the "backend" label.
+	// Defaults to the name of the LoggingBackend followed by the backend type.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Source is the LoggingBackend, <namespace>/<name>, the config was loaded from.
+	Source string `json:"-" yaml:"-"`
+
 	ElasticSearch *ElasticSearchBackendConfig    `json:"elasticsearch,omitempty" yaml:"elasticsearch,omitempty"`
 	OpenSearch    *OpenSearchBackendConfig       `json:"opensearch,omitempty" yaml:"opensearch,omitempty"`
 	CloudWatch    *CloudWatchBackendConfig       `json:"cloudwatch,omitempty" yaml:"cloudwatch,omitempty"`
@@ -30,28 +43,133 @@ type SearchBackendConfig struct {
 	File          *FileSearchBackendConfig       `json:"file,omitempty" yaml:"file,omitempty"`
 }
 
-func NewSearchBackend(api SearchAPI) SearchBackend {
-	return SearchBackend{
-		API: api,
+// Backend types
+const (
+	BackendTypeCloudWatch    = "cloudwatch"
+	BackendTypeElasticSearch = "elasticsearch"
+	BackendTypeFile          = "file"
+	BackendTypeKubernetes    = "kubernetes"
+	BackendTypeOpenSearch    = "opensearch"
+)
+
+// Types returns the types of backends configured in this config.
+func (t SearchBackendConfig) Types() []string {
+	var types []string
+	if t.CloudWatch != nil {
+		types = append(types, BackendTypeCloudWatch)
+	}
+	if t.ElasticSearch != nil {
+		types = append(types, BackendTypeElasticSearch)
+	}
+	if t.File != nil {
+		types = append(types, BackendTypeFile)
+	}
+	if t.Kubernetes != nil {
+		types = append(types, BackendTypeKubernetes)
+	}
+	if t.OpenSearch != nil {
+		types = append(types, BackendTypeOpenSearch)
+	}
+
+	return types
+}
+
+// BackendName returns the name of the backend of the given type in this config.
+func (t SearchBackendConfig) BackendName(backendType string) string {
+	if t.Name == "" {
+		if t.Source == "" {
+			return backendType
+		}
+		return t.Source + "/" + backendType
+	}
+
+	// A single config can declare more than one backend
+	// in which case the type is needed to tell them apart.
+	if len(t.Types()) > 1 {
+		return t.Name + "/" + backendType
+	}
+
+	return t.Name
+}
+
+func NewSearchBackend(name, backendType string, api SearchAPI, config CommonBackend) (SearchBackend, error) {
+	timeout, err := config.GetTimeout()
+	if err != nil {
+		return SearchBackend{}, err
+	}
+
+	if err := config.Routes.Validate(); err != nil {
+		return SearchBackend{}, err
+	}
+
+	if config.Parse != nil {
+		if err := config.Parse.Validate(); err != nil {
+			return SearchBackend{}, err
+		}
 	}
+
+	return SearchBackend{
+		Name:    name,
+		Type:    backendType,
+		API:     api,
+		Routes:  config.Routes,
+		Timeout: timeout,
+		Parse:   config.Parse,
+	}, nil
 }
 
 type SearchBackend struct {
-	API SearchAPI
+	// Name uniquely identifies the backend
+	Name string
+	// Type is the kind of the backend, e.g. elasticsearch, kubernetes
+	Type string
+	API  SearchAPI
+
+	// Routes decide which searches the backend serves
+	Routes Routes
+
+	// Timeout is the maximum duration a single search against this backend may take.
+	// Zero means the server wide default applies.
+	Timeout time.Duration
+
+	// Parse parses the messages of the results into labels when set
+	Parse *ParseConfig
 }
 
 type Routes []SearchRoute
 
-func (t Routes) MatchRoute(q *SearchParams) (match bool, isAdditive bool) {
-	for _, route := range t {
-		if route.Match(q) {
-			return true, route.IsAdditive
+// Validate validates every route.
+func (t Routes) Validate() error {
+	for i := range t {
+		if err := t[i].Validate(); err != nil {
+			return err
 		}
 	}
 
+	return nil
+}
+
+func (t Routes) MatchRoute(q *SearchParams) (match bool, isAdditive bool) {
+	if route := t.Find(q); route != nil {
+		return true, route.IsAdditive
+	}
+
 	return false, false
 }
 
+// Find returns the route, with the highest priority, that matches the search params.
+// Among routes of the same priority the first one wins.
+func (t Routes) Find(q *SearchParams) *SearchRoute {
+	var matched *SearchRoute
+	for i := range t {
+		if (matched == nil || t[i].Priority > matched.Priority) && t[i].Match(q) {
+			matched = &t[i]
+		}
+	}
+
+	return matched
+}
+
 // +kubebuilder:object:generate=true
 type CommonBackend struct {
 	Routes Routes `yaml:"routes,omitempty" json:"routes,omitempty"`
@@ -59,40 +177,165 @@ type CommonBackend struct {
 	// Labels are custom labels specified in the configuration file for a backend
 	// that will be attached to each log line returned by that backend.
 	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+
+	// Timeout is the maximum duration of a search against this backend (e.g. "30s", "2m").
+	// Defaults to the server wide backend timeout.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	// LabelMapping maps the canonical label keys (pod, namespace, container, node, host, level)
+	// to the fields of the backend. It overrides the default mapping of the backend type.
+	LabelMapping map[string]string `yaml:"labelMapping,omitempty" json:"label_mapping,omitempty"`
+
+	// Parse parses the structured messages of the backend, e.g. JSON or logfmt, into labels.
+	Parse *ParseConfig `yaml:"parse,omitempty" json:"parse,omitempty"`
+}
+
+// GetLabelMapping returns the label mapping of the backend type
+// with the configured label mapping applied.
+func (t CommonBackend) GetLabelMapping(backendType string) LabelMapping {
+	return NewLabelMapping(backendType, t.LabelMapping)
+}
+
+// GetTimeout parses the configured timeout.
+// A zero duration is returned when no timeout is configured.
+func (t CommonBackend) GetTimeout() (time.Duration, error) {
+	if t.Timeout == "" {
+		return 0, nil
+	}
+
+	d, err := durationUtil.ParseDuration(t.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", t.Timeout, err)
+	}
+
+	return time.Duration(d), nil
 }
 
 type SearchBackendConfigs []SearchBackendConfig
 
 // +kubebuilder:object:generate=true
 type SearchRoute struct {
-	Type       string            `yaml:"type,omitempty" json:"type,omitempty"`
-	IdPrefix   string            `yaml:"idPrefix,omitempty" json:"id_prefix,omitempty"`
-	Labels     map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
-	IsAdditive bool              `yaml:"additive,omitempty" json:"is_additive,omitempty"`
+	// Type matches the type of the search. Supports glob patterns, e.g. Kubernetes*
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// TypeRegex is a regular expression the type of the search must match
+	TypeRegex string `yaml:"typeRegex,omitempty" json:"type_regex,omitempty"`
+	// Id is a glob pattern the id of the search must match, e.g. cluster-*/nginx-*
+	Id string `yaml:"id,omitempty" json:"id,omitempty"`
+	// IdRegex is a regular expression the id of the search must match
+	IdRegex  string            `yaml:"idRegex,omitempty" json:"id_regex,omitempty"`
+	IdPrefix string            `yaml:"idPrefix,omitempty" json:"id_prefix,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+
+	// OlderThan matches searches whose time range starts before the given age (e.g. 7d)
+	OlderThan string `yaml:"olderThan,omitempty" json:"older_than,omitempty"`
+	// NewerThan matches searches whose time range ends after the given age (e.g. 7d)
+	NewerThan string `yaml:"newerThan,omitempty" json:"newer_than,omitempty"`
+
+	// Priority orders the backends matched by a search, highest first.
+	// The first additive route in that order wins.
+	Priority   int  `yaml:"priority,omitempty" json:"priority,omitempty"`
+	IsAdditive bool `yaml:"additive,omitempty" json:"is_additive,omitempty"`
+
+	// Fallbacks are the names of the backends that are searched, in order,
+	// when the search on this backend fails or times out.
+	Fallbacks []string `yaml:"fallbacks,omitempty" json:"fallbacks,omitempty"`
+
+	// Rewrite rewrites the search before it reaches the backend
+	Rewrite *SearchRewrite `yaml:"rewrite,omitempty" json:"rewrite,omitempty"`
 }
 
 func (t *SearchRoute) Match(q *SearchParams) bool {
-	if t.Type != "" && t.Type != q.Type {
-		return false
+	match, _ := t.Explain(q)
+	return match
+}
+
+// Explain reports whether the route matches the search params
+// and, when it doesn't, the condition that failed.
+func (t *SearchRoute) Explain(q *SearchParams) (match bool, reason string) {
+	if t.Type != "" && !matchGlob(t.Type, q.Type) {
+		return false, fmt.Sprintf("type %q does not match %q", q.Type, t.Type)
+	}
+
+	if t.TypeRegex != "" && !matchRegex(t.TypeRegex, q.Type) {
+		return false, fmt.Sprintf("type %q does not match the regex %q", q.Type, t.TypeRegex)
+	}
+
+	if t.Id != "" && !matchGlob(t.Id, q.Id) {
+		return false, fmt.Sprintf("id %q does not match %q", q.Id, t.Id)
+	}
+
+	if t.IdRegex != "" && !matchRegex(t.IdRegex, q.Id) {
+		return false, fmt.Sprintf("id %q does not match the regex %q", q.Id, t.IdRegex)
 	}
 
 	if t.IdPrefix != "" && !strings.HasPrefix(q.Id, t.IdPrefix) {
-		return false
+		return false, fmt.Sprintf("id %q does not have the prefix %q", q.Id, t.IdPrefix)
+	}
+
+	keys := make([]string, 0, len(t.Labels))
+	for k := range t.Labels {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	for k, v := range t.Labels {
+	for _, k := range keys {
+		v := t.Labels[k]
 		qVal, ok := q.Labels[k]
 		if !ok {
-			return false
+			return false, fmt.Sprintf("label %q is missing", k)
 		}
 
 		configuredLabels := strings.Split(v, ",")
 		if !collections.MatchItems(qVal, configuredLabels...) {
-			return false
+			if collections.Contains(configuredLabels, "!"+qVal) {
+				return false, fmt.Sprintf("label %s=%q is excluded by %q", k, qVal, v)
+			}
+			return false, fmt.Sprintf("label %s=%q does not match %q", k, qVal, v)
 		}
 	}
 
-	return true
+	if t.OlderThan != "" {
+		if start := q.GetStart(); start != nil && !start.Before(ageToTime(t.OlderThan)) {
+			return false, fmt.Sprintf("start %s is not older than %s", start.UTC().Format(time.RFC3339), t.OlderThan)
+		}
+	}
+
+	if t.NewerThan != "" {
+		end := time.Now()
+		if e := q.GetEnd(); e != nil {
+			end = *e
+		}
+		if !end.After(ageToTime(t.NewerThan)) {
+			return false, fmt.Sprintf("end %s is not newer than %s", end.UTC().Format(time.RFC3339), t.NewerThan)
+		}
+	}
+
+	return true, ""
+}
+
+// Validate checks the patterns and ages of the route.
+func (t *SearchRoute) Validate() error {
+	for _, expr := range []string{t.TypeRegex, t.IdRegex} {
+		if _, err := compileRegex(expr); err != nil {
+			return fmt.Errorf("invalid route regex %q: %w", expr, err)
+		}
+	}
+
+	for _, age := range []string{t.OlderThan, t.NewerThan} {
+		if age == "" {
+			continue
+		}
+
+		if _, err := durationUtil.ParseDuration(age); err != nil {
+			return fmt.Errorf("invalid route age %q: %w", age, err)
+		}
+	}
+
+	if t.Rewrite != nil {
+		return t.Rewrite.Validate()
+	}
+
+	return nil
 }
 
 // +kubebuilder:object:generate=true
@@ -102,12 +345,90 @@ type KubernetesSearchBackendConfig struct {
 	Kubeconfig *kommons.EnvVar `json:"kubeconfig,omitempty"`
 	//namespace to search the kommons.EnvVar in
 	Namespace string `json:"namespace,omitempty"`
+
+	// Multiline folds the lines of multiline events, like stack traces, into a single result
+	Multiline *MultilineConfig `json:"multiline,omitempty" yaml:"multiline,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
 type FileSearchBackendConfig struct {
 	CommonBackend `json:",inline" yaml:",inline"`
 	Paths         []string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// Parser parses every line of the files into labels
+	Parser *FileParser `yaml:"parser,omitempty" json:"parser,omitempty"`
+
+	// TimestampLayout is the layout, in Go's reference time, of the timestamps of the lines, e.g. "2006/01/02 15:04:05".
+	// Defaults to the layout detected in the first lines of every file.
+	// Lines without a timestamp have the timestamp of the line before them.
+	TimestampLayout string `yaml:"timestampLayout,omitempty" json:"timestamp_layout,omitempty"`
+
+	// Index maintains a sparse index of the timestamps of the lines of the files,
+	// so the lines of a time window are found without searching the files
+	Index *FileIndex `yaml:"index,omitempty" json:"index,omitempty"`
+
+	// Multiline folds the lines of multiline events, like stack traces, into a single result
+	Multiline *MultilineConfig `yaml:"multiline,omitempty" json:"multiline,omitempty"`
+
+	// SSH reads the files on remote hosts over SSH rather than on the local filesystem
+	SSH *SSHConnection `yaml:"ssh,omitempty" json:"ssh,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// SSHConnection connects to remote hosts over SSH to search their files.
+//
+// The files are filtered on the hosts, with grep when the query allows it, and only
+// the last lines of every file are transferred. Tailing remote files isn't supported.
+type SSHConnection struct {
+	// Hosts are the addresses of the hosts, host or host:port. The port defaults to 22
+	Hosts []string `yaml:"hosts" json:"hosts"`
+
+	Namespace  string          `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
+	Username   *kommons.EnvVar `yaml:"username,omitempty" json:"username,omitempty"`
+	Password   *kommons.EnvVar `yaml:"password,omitempty" json:"password,omitempty"`
+	PrivateKey *kommons.EnvVar `yaml:"privateKey,omitempty" json:"private_key,omitempty"`
+	// Passphrase decrypts the private key when it's encrypted
+	Passphrase *kommons.EnvVar `yaml:"passphrase,omitempty" json:"passphrase,omitempty"`
+
+	// HostKeys are the public keys of the hosts in the authorized_keys format, e.g. ssh-ed25519 AAAA...
+	// A host is trusted when its key is one of them.
+	HostKeys []string `yaml:"hostKeys,omitempty" json:"host_keys,omitempty"`
+
+	// InsecureIgnoreHostKey trusts the hosts without verifying their keys
+	InsecureIgnoreHostKey bool `yaml:"insecureIgnoreHostKey,omitempty" json:"insecure_ignore_host_key,omitempty"`
+
+	// Lines is the maximum number of lines read from the end of every file, after they're filtered. Defaults to 10000
+	Lines int `yaml:"lines,omitempty" json:"lines,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// FileIndex is a sparse index, on disk, of the timestamps of the lines of files.
+// It's updated as the files grow and rebuilt when they're rotated or truncated.
+type FileIndex struct {
+	// Dir is the directory the indexes are stored in. Defaults to the directory of every file.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+
+	// Interval is the number of lines between two entries of an index. Defaults to 1000
+	Interval int `yaml:"interval,omitempty" json:"interval,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// FileParser parses the lines of files into labels with a built-in pattern or a regular expression.
+//
+// The named groups of the pattern become the labels of a line, except for the timestamp group
+// that sets the time of the line, the message group that replaces the line as the message
+// and the level, or the syslog priority, group that is normalised into the level label.
+type FileParser struct {
+	// Pattern is one of the built-in patterns: nginx, nginx-error, apache, syslog-rfc3164, syslog-rfc5424 or klog
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+
+	// Regex is a regular expression with named groups, e.g. (?P<status>\d+).
+	// It may use grok patterns, e.g. %{IPORHOST:client}
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+
+	// TimestampLayout is the layout of the timestamp group in Go's reference time, e.g. "2006/01/02 15:04:05".
+	// Defaults to the layout of the built-in pattern, or to the commonly used layouts.
+	TimestampLayout string `yaml:"timestampLayout,omitempty" json:"timestamp_layout,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
@@ -172,7 +493,8 @@ type SearchParams struct {
 	// comma separated list of labels to filter the results. key1=value1,key2=value2
 	Labels map[string]string `json:"labels,omitempty"`
 	// A generic query string, that is rewritten to the underlying system,
-	// If the underlying system does not support queries, than this query is applied on the returned results
+	// If the underlying system does not support queries, than this query is applied on the returned results.
+	// e.g. `error pod:nginx-* AND NOT level:debug`. See the query package for the syntax.
 	Query string `json:"query,omitempty"`
 	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w"), default to 1h
 	Start string `json:"start,omitempty"`
@@ -187,6 +509,19 @@ type SearchParams struct {
 	LimitPerItem int64 `json:"limitPerItem,omitempty"`
 	// Limits the number of bytes returned per item, e.g. pod
 	LimitBytesPerItem int64 `json:"limitBytesPerItem,omitempty"`
+	// The order in which the results are returned, either "desc" (newest first) or "asc". Defaults to desc
+	Sort string `json:"sort,omitempty"`
+	// Strict fails the whole search when any of the matched backends fails
+	// instead of returning the results of the remaining backends.
+	Strict bool `json:"strict,omitempty"`
+	// Backends restricts the search to the backends with the given names.
+	// The backends must still match the routes of the search.
+	Backends []string `json:"backends,omitempty"`
+	// Facets are the labels, e.g. namespace or level, whose most frequent values
+	// over the matched results are returned with the results.
+	Facets []string `json:"facets,omitempty"`
+	// FacetLimit is the number of values returned per facet. Defaults to 10
+	FacetLimit int `json:"facetLimit,omitempty"`
 
 	start *time.Time `json:"-"`
 	end   *time.Time `json:"-"`
@@ -210,6 +545,10 @@ func (t *SearchParams) SetDefaults() {
 	if t.LimitBytesPerItem == 0 {
 		t.LimitBytesPerItem = 100 * 1024
 	}
+
+	if t.Sort != SortAscending {
+		t.Sort = SortDescending
+	}
 }
 
 func (p SearchParams) GetStartISO() string {
@@ -236,6 +575,12 @@ func (p *SearchParams) GetStart() *time.Time {
 	return p.start
 }
 
+// SetStart sets the start of the search to the given time.
+func (p *SearchParams) SetStart(t time.Time) {
+	p.Start = t.UTC().Format(time.RFC3339Nano)
+	p.start = &t
+}
+
 func (p *SearchParams) GetEnd() *time.Time {
 	if p.end != nil {
 		return p.end
@@ -251,6 +596,66 @@ func (p *SearchParams) GetEnd() *time.Time {
 	return p.end
 }
 
+// Clone returns a copy of the search params that can be
+// modified without affecting the original.
+func (p SearchParams) Clone() *SearchParams {
+	clone := p
+	if p.Labels != nil {
+		clone.Labels = make(map[string]string, len(p.Labels))
+		for k, v := range p.Labels {
+			clone.Labels[k] = v
+		}
+	}
+	if p.Backends != nil {
+		clone.Backends = append([]string(nil), p.Backends...)
+	}
+	if p.Facets != nil {
+		clone.Facets = append([]string(nil), p.Facets...)
+	}
+
+	return &clone
+}
+
+// SelectsBackend reports whether the search is allowed to run on the named backend
+// by the backends of the search and its backend label.
+func (p SearchParams) SelectsBackend(name string) bool {
+	if value, ok := p.Labels[LabelBackend]; ok && !collections.MatchItems(name, strings.Split(value, ",")...) {
+		return false
+	}
+	return len(p.Backends) == 0 || collections.Contains(p.Backends, name)
+}
+
+// InTimeRange reports whether the result is within the start and end of the search.
+// Results without a timestamp are always kept.
+func (p *SearchParams) InTimeRange(r Result) bool {
+	t, ok := r.GetTime()
+	if !ok {
+		return true
+	}
+
+	if start := p.GetStart(); start != nil && t.Before(*start) {
+		return false
+	}
+	if end := p.GetEnd(); end != nil && t.After(*end) {
+		return false
+	}
+
+	return true
+}
+
+// MatchLabels reports whether the result has every label of the search.
+// The value of a label is a comma separated list of values, any of which matches.
+func (p SearchParams) MatchLabels(r Result) bool {
+	for k, v := range p.Labels {
+		value, ok := r.Labels[k]
+		if !ok || !collections.MatchItems(value, strings.Split(v, ",")...) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (q SearchParams) String() string {
 	s := ""
 	if q.Type != "" {
@@ -277,6 +682,12 @@ func (q SearchParams) String() string {
 	if q.Page != "" {
 		s += fmt.Sprintf("page=%s ", q.Page)
 	}
+	if q.Sort != "" {
+		s += fmt.Sprintf("sort=%s ", q.Sort)
+	}
+	if len(q.Backends) > 0 {
+		s += fmt.Sprintf("backends=%v ", q.Backends)
+	}
 	return s
 }
 
@@ -284,6 +695,47 @@ type SearchResults struct {
 	Total    int      `json:"total,omitempty"`
 	Results  []Result `json:"results,omitempty"`
 	NextPage string   `json:"nextPage,omitempty"`
+
+	// Facets holds the most frequent values of the requested labels over the matched results
+	Facets Facets `json:"facets,omitempty"`
+
+	// Backends reports the outcome of the search on each of the matched backends
+	Backends []BackendStatus `json:"backends,omitempty"`
+}
+
+// HasErrors reports whether any of the backends, whose results weren't discarded, failed.
+func (r SearchResults) HasErrors() bool {
+	for _, b := range r.Backends {
+		if b.Error != "" && !b.Discarded {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BackendStatus is the outcome of a search on a single backend.
+type BackendStatus struct {
+	// Backend is the name of the backend
+	Backend string `json:"backend"`
+	// Type is the kind of the backend, e.g. elasticsearch, kubernetes
+	Type string `json:"type"`
+	// Duration is the time taken by the backend in milliseconds
+	Duration int64 `json:"duration"`
+	// Results is the number of results of the backend included in the response
+	Results int `json:"results"`
+	// Total is the total number of results reported by the backend
+	Total int `json:"total,omitempty"`
+	// Truncated is set when the backend has more results than the ones returned
+	Truncated bool `json:"truncated,omitempty"`
+	// Discarded is set when the results were dropped in favour of an additive route
+	Discarded bool `json:"discarded,omitempty"`
+	// Fallback is the backend that served the search after this backend failed
+	Fallback string `json:"fallback,omitempty"`
+	// FallbackReason is the error of this backend that triggered the fallback
+	FallbackReason string `json:"fallbackReason,omitempty"`
+	// Error is set when the backend, and all its fallbacks, failed
+	Error string `json:"error,omitempty"`
 }
 
 func (r *SearchResults) Append(other *SearchResults) {
@@ -299,6 +751,23 @@ type Result struct {
 	Time    string            `json:"timestamp,omitempty"`
 	Message string            `json:"message,omitempty"`
 	Labels  map[string]string `json:"labels,omitempty"`
+
+	// Cursor is the backend specific page token that resumes the search right after this result.
+	// It allows resuming a backend whose results were cut short by the limits of the search.
+	Cursor string `json:"-"`
+}
+
+// WithLabel returns a copy of the result with the given label set.
+// The labels map of a result is often shared among many results,
+// so it is copied rather than modified in place.
+func (r Result) WithLabel(key, value string) Result {
+	labels := make(map[string]string, len(r.Labels)+1)
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	labels[key] = value
+	r.Labels = labels
+	return r
 }
 
 func (r Result) Process() Result {
@@ -317,10 +786,49 @@ func (r Result) Process() Result {
 
 // +kubebuilder:object:generate=false
 type SearchAPI interface {
-	Search(q *SearchParams) (r SearchResults, err error)
-	MatchRoute(q *SearchParams) (match bool, isAdditive bool)
+	// Search runs the query against the backend.
+	// Implementations must abort and return when the context is done.
+	Search(ctx context.Context, q *SearchParams) (r SearchResults, err error)
+
+	// Capabilities are the parts of the search the backend applies itself.
+	// The parts it doesn't apply are applied to its results after the search.
+	Capabilities() Capabilities
+}
+
+// Capabilities declares which parts of a search a backend pushes down to the underlying system.
+type Capabilities struct {
+	// TimeRange is set when the results are bounded by the start and end of the search
+	TimeRange bool `json:"timeRange,omitempty"`
+	// Query is set when the query of the search is translated for the underlying system
+	Query bool `json:"query,omitempty"`
+	// Labels is set when the results only match the labels of the search
+	Labels bool `json:"labels,omitempty"`
+	// Limit is set when the backend returns at most Limit results
+	Limit bool `json:"limit,omitempty"`
+	// Page is set when the backend returns its own page tokens.
+	// A backend that paginates must also apply the limit.
+	Page bool `json:"page,omitempty"`
+	// Facets is set when the backend counts the facets over all of its matched results
+	Facets bool `json:"facets,omitempty"`
+	// Parse is set when the backend parses its results with the parse config of the backend
+	// before applying the search, so the parsed labels can be searched
+	Parse bool `json:"parse,omitempty"`
+}
+
+// All reports whether the backend applies every part of a search itself.
+// Parsing isn't a part of the search, as it's applied to the results either way.
+func (c Capabilities) All() bool {
+	return c.TimeRange && c.Query && c.Labels && c.Limit && c.Page && c.Facets
+}
+
+// +kubebuilder:object:generate=false
+// QueryRenderer is implemented by the backends that render a query template
+// from the search params before sending it to the underlying system.
+type QueryRenderer interface {
+	RenderQuery(q *SearchParams) (string, error)
 }
 
+// SearchMapper maps a search into the searches run on a backend.
 type SearchMapper interface {
 	MapSearchParams(p *SearchParams) ([]SearchParams, error)
 }
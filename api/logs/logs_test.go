@@ -208,3 +208,170 @@ func TestSearchRoute_Match(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchRoute_Explain(t *testing.T) {
+	route := &SearchRoute{
+		Type:     "pod",
+		IdPrefix: "search",
+		Labels: map[string]string{
+			"app": "backend,!frontend",
+			"env": "*",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		args   *SearchParams
+		reason string
+	}{
+		{
+			name:   "match",
+			args:   &SearchParams{Type: "pod", Id: "search-1234", Labels: map[string]string{"app": "backend", "env": "prod"}},
+			reason: "",
+		},
+		{
+			name:   "type",
+			args:   &SearchParams{Type: "node", Id: "search-1234"},
+			reason: `type "node" does not match "pod"`,
+		},
+		{
+			name:   "prefix",
+			args:   &SearchParams{Type: "pod", Id: "pod-1234"},
+			reason: `id "pod-1234" does not have the prefix "search"`,
+		},
+		{
+			name:   "missing label",
+			args:   &SearchParams{Type: "pod", Id: "search-1234", Labels: map[string]string{"app": "backend"}},
+			reason: `label "env" is missing`,
+		},
+		{
+			name:   "label mismatch",
+			args:   &SearchParams{Type: "pod", Id: "search-1234", Labels: map[string]string{"app": "search", "env": "prod"}},
+			reason: `label app="search" does not match "backend,!frontend"`,
+		},
+		{
+			name:   "negated label",
+			args:   &SearchParams{Type: "pod", Id: "search-1234", Labels: map[string]string{"app": "frontend", "env": "prod"}},
+			reason: `label app="frontend" is excluded by "backend,!frontend"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, reason := route.Explain(tt.args)
+			if match != (tt.reason == "") || reason != tt.reason {
+				t.Errorf("SearchRoute.Explain() = %v, %q, want %q", match, reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSearchRoute_MatchPatterns(t *testing.T) {
+	tests := []struct {
+		name  string
+		route SearchRoute
+		args  *SearchParams
+		want  bool
+	}{
+		{
+			name:  "type glob",
+			route: SearchRoute{Type: "Kubernetes*"},
+			args:  &SearchParams{Type: "KubernetesPod"},
+			want:  true,
+		},
+		{
+			name:  "type glob - not match",
+			route: SearchRoute{Type: "Kubernetes*"},
+			args:  &SearchParams{Type: "VM"},
+			want:  false,
+		},
+		{
+			name:  "type regex",
+			route: SearchRoute{TypeRegex: "^Kubernetes(Pod|Deployment)$"},
+			args:  &SearchParams{Type: "KubernetesDeployment"},
+			want:  true,
+		},
+		{
+			name:  "id glob",
+			route: SearchRoute{Id: "cluster-*/nginx-?"},
+			args:  &SearchParams{Id: "cluster-main/nginx-1"},
+			want:  true,
+		},
+		{
+			name:  "id regex - not match",
+			route: SearchRoute{IdRegex: `^cluster-\d+/`},
+			args:  &SearchParams{Id: "cluster-main/nginx-1"},
+			want:  false,
+		},
+		{
+			name:  "older than",
+			route: SearchRoute{OlderThan: "7d"},
+			args:  &SearchParams{Start: "10d"},
+			want:  true,
+		},
+		{
+			name:  "older than - recent search",
+			route: SearchRoute{OlderThan: "7d"},
+			args:  &SearchParams{Start: "1h"},
+			want:  false,
+		},
+		{
+			name:  "newer than",
+			route: SearchRoute{NewerThan: "7d"},
+			args:  &SearchParams{Start: "10d"},
+			want:  true,
+		},
+		{
+			name:  "newer than - old search",
+			route: SearchRoute{NewerThan: "7d"},
+			args:  &SearchParams{Start: "30d", End: "10d"},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.Match(tt.args); got != tt.want {
+				t.Errorf("SearchRoute.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutes_Find(t *testing.T) {
+	routes := Routes{
+		{Type: "KubernetesPod"},
+		{Type: "Kubernetes*", Priority: 10, IsAdditive: true},
+		{Type: "KubernetesPod", Priority: 10},
+	}
+
+	if got := routes.Find(&SearchParams{Type: "KubernetesPod"}); got != &routes[1] {
+		t.Errorf("Routes.Find() = %v, want %v", got, routes[1])
+	}
+
+	if got := routes.Find(&SearchParams{Type: "VM"}); got != nil {
+		t.Errorf("Routes.Find() = %v, want nil", got)
+	}
+}
+
+func TestSearchParams_SelectsBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  SearchParams
+		backend string
+		want    bool
+	}{
+		{name: "any", backend: "pods", want: true},
+		{name: "named", params: SearchParams{Backends: []string{"files"}}, backend: "pods", want: false},
+		{name: "label", params: SearchParams{Labels: map[string]string{LabelBackend: "files,pods"}}, backend: "pods", want: true},
+		{name: "other label", params: SearchParams{Labels: map[string]string{LabelBackend: "files"}}, backend: "pods", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.SelectsBackend(tt.backend); got != tt.want {
+				t.Errorf("SearchParams.SelectsBackend() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
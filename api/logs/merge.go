@@ -0,0 +1,189 @@
+package logs
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// timestampLayouts are the layouts in which the backends are known to return timestamps.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.UnixDate,
+}
+
+// ParseTimestamp parses the timestamp returned by a backend.
+func ParseTimestamp(timestamp string) (time.Time, bool) {
+	timestamp = strings.TrimSpace(timestamp)
+	if timestamp == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// GetTime returns the parsed timestamp of the result.
+func (r Result) GetTime() (time.Time, bool) {
+	return ParseTimestamp(r.Time)
+}
+
+// Normalize rewrites the timestamp of the result in RFC3339 (UTC)
+// so results from different backends are comparable.
+func (r Result) Normalize() Result {
+	if t, ok := r.GetTime(); ok {
+		r.Time = t.UTC().Format(time.RFC3339Nano)
+	}
+
+	return r
+}
+
+// timedResult is a result whose timestamp has been parsed.
+type timedResult struct {
+	Result
+	time    time.Time
+	hasTime bool
+}
+
+// before reports whether a should be returned before b in the given sort order.
+// Results without a timestamp are always placed last.
+func (a timedResult) before(b timedResult, order string) bool {
+	if !a.hasTime || !b.hasTime {
+		return a.hasTime && !b.hasTime
+	}
+
+	if order == SortAscending {
+		return a.time.Before(b.time)
+	}
+
+	return a.time.After(b.time)
+}
+
+func toTimedResults(results []Result, order string) []timedResult {
+	timed := make([]timedResult, 0, len(results))
+	for _, r := range results {
+		r = r.Normalize()
+		t, ok := r.GetTime()
+		timed = append(timed, timedResult{Result: r, time: t, hasTime: ok})
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].before(timed[j], order)
+	})
+
+	return timed
+}
+
+// cursor points to the next result to consume from a stream
+type cursor struct {
+	stream int
+	index  int
+}
+
+type mergeHeap struct {
+	streams [][]timedResult
+	cursors []cursor
+	order   string
+}
+
+func (h mergeHeap) Len() int { return len(h.cursors) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	a := h.streams[h.cursors[i].stream][h.cursors[i].index]
+	b := h.streams[h.cursors[j].stream][h.cursors[j].index]
+	if a.before(b, h.order) {
+		return true
+	}
+	if b.before(a, h.order) {
+		return false
+	}
+
+	// Keep the backend order for results with the same timestamp
+	return h.cursors[i].stream < h.cursors[j].stream
+}
+
+func (h mergeHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x any) { h.cursors = append(h.cursors, x.(cursor)) }
+
+func (h *mergeHeap) Pop() any {
+	old := h.cursors
+	n := len(old)
+	c := old[n-1]
+	h.cursors = old[:n-1]
+	return c
+}
+
+// MergedResults is the outcome of merging multiple result streams.
+type MergedResults struct {
+	Results []Result
+
+	// Consumed is the number of results taken from each stream.
+	Consumed []int
+
+	// Cursors holds the cursor of the last result taken from each stream.
+	Cursors []string
+}
+
+// MergeResults merges the results of multiple backends into a single list
+// ordered by time, in the given sort order.
+//
+// The merged list stops at limit results or once the total size of the messages
+// would exceed limitBytes. A limit of 0 means no limit.
+func MergeResults(order string, limit, limitBytes int64, streams ...[]Result) MergedResults {
+	h := &mergeHeap{order: order, streams: make([][]timedResult, len(streams))}
+	for i, stream := range streams {
+		h.streams[i] = toTimedResults(stream, order)
+		if len(h.streams[i]) > 0 {
+			h.cursors = append(h.cursors, cursor{stream: i})
+		}
+	}
+	heap.Init(h)
+
+	merged := MergedResults{
+		Consumed: make([]int, len(streams)),
+		Cursors:  make([]string, len(streams)),
+	}
+	var size int64
+	for h.Len() > 0 {
+		if limit > 0 && int64(len(merged.Results)) >= limit {
+			break
+		}
+
+		c := h.cursors[0]
+		next := h.streams[c.stream][c.index]
+		if limitBytes > 0 && size+int64(len(next.Message)) > limitBytes {
+			break
+		}
+
+		merged.Results = append(merged.Results, next.Result)
+		merged.Consumed[c.stream]++
+		merged.Cursors[c.stream] = next.Cursor
+		size += int64(len(next.Message))
+
+		if c.index+1 < len(h.streams[c.stream]) {
+			h.cursors[0].index++
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+
+	return merged
+}
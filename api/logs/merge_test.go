@@ -0,0 +1,96 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	es := []Result{
+		{Message: "es-3", Time: "2023-03-09T12:03:00.000Z"},
+		{Message: "es-1", Time: "2023-03-09T12:01:00.000Z"},
+	}
+	k8s := []Result{
+		{Message: "k8s-2", Time: "2023-03-09T12:02:00.123456789Z"},
+		{Message: "k8s-4", Time: "2023-03-09T14:04:00+02:00"},
+	}
+	cloudwatch := []Result{
+		{Message: "cw-0", Time: "2023-03-09 12:00:00.000"},
+		{Message: "cw-none"},
+	}
+
+	tests := []struct {
+		name       string
+		order      string
+		limit      int64
+		limitBytes int64
+		want       []string
+		consumed   []int
+	}{
+		{
+			name:     "descending",
+			order:    SortDescending,
+			want:     []string{"k8s-4", "es-3", "k8s-2", "es-1", "cw-0", "cw-none"},
+			consumed: []int{2, 2, 2},
+		},
+		{
+			name:     "ascending",
+			order:    SortAscending,
+			want:     []string{"cw-0", "es-1", "k8s-2", "es-3", "k8s-4", "cw-none"},
+			consumed: []int{2, 2, 2},
+		},
+		{
+			name:     "limit",
+			order:    SortDescending,
+			limit:    3,
+			want:     []string{"k8s-4", "es-3", "k8s-2"},
+			consumed: []int{1, 2, 0},
+		},
+		{
+			name:       "limit bytes",
+			order:      SortAscending,
+			limitBytes: 10,
+			want:       []string{"cw-0", "es-1"},
+			consumed:   []int{1, 0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := MergeResults(tt.order, tt.limit, tt.limitBytes, es, k8s, cloudwatch)
+
+			var got []string
+			for _, r := range merged.Results {
+				got = append(got, r.Message)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeResults() = %v, want %v", got, tt.want)
+			}
+
+			if !reflect.DeepEqual(merged.Consumed, tt.consumed) {
+				t.Errorf("MergeResults() consumed = %v, want %v", merged.Consumed, tt.consumed)
+			}
+		})
+	}
+}
+
+func TestResult_Normalize(t *testing.T) {
+	tests := []struct {
+		time string
+		want string
+	}{
+		{time: "2023-03-09T14:04:00+02:00", want: "2023-03-09T12:04:00Z"},
+		{time: "2023-03-09 12:00:00.000", want: "2023-03-09T12:00:00Z"},
+		{time: "2023-03-09T12:02:00.123Z", want: "2023-03-09T12:02:00.123Z"},
+		{time: "not a time", want: "not a time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.time, func(t *testing.T) {
+			if got := (Result{Time: tt.time}).Normalize().Time; got != tt.want {
+				t.Errorf("Result.Normalize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Built-in detectors of the continuation lines of stack traces.
+const (
+	MultilineJava   = "java"
+	MultilinePython = "python"
+	MultilineGo     = "go"
+)
+
+// DefaultMultilineMaxLines is the default maximum number of lines of a multiline event.
+const DefaultMultilineMaxLines = 500
+
+// multilineDetectors match the lines that continue the event before them in stack traces.
+var multilineDetectors = map[string]*regexp.Regexp{
+	// at com.acme.Api.get(Api.java:12), ... 5 more, Caused by: and the exception, e.g. java.lang.IllegalStateException: closed
+	MultilineJava: regexp.MustCompile(`^(\s+at\s|\s*\.\.\. \d+ (more|common frames omitted)|\s*Caused by:|\s+Suppressed:|[\w$.]+(Exception|Error|Throwable)(:.*)?$)`),
+	// Traceback (most recent call last):, the indented frames, chained exceptions and the exception, e.g. KeyError: 'id'
+	MultilinePython: regexp.MustCompile(`^(Traceback \(most recent call last\):|\s+\S|During handling of the above exception|The above exception was the direct cause|[\w.]+(Error|Exception|Exit|Interrupt|Warning)(:.*)?$)`),
+	// goroutine 1 [running]:, the functions and their indented files, created by, [signal ...] and exit status
+	MultilineGo: regexp.MustCompile(`^(goroutine \d+ \[.*\]:$|\s+\S|[\w./*()%-]+\(.*\)$|created by |\[signal |exit status \d+$)`),
+}
+
+// +kubebuilder:object:generate=true
+// MultilineConfig folds the lines of multiline events, like stack traces, into a single result
+// that has the time of the first line of the event.
+//
+// An event continues with the lines that don't match the start pattern, or with the lines that
+// match the continuation pattern or a detector. Empty lines continue the events of detectors.
+type MultilineConfig struct {
+	// Start is a regular expression matching the first line of every event, e.g. ^\d{4}-\d{2}-\d{2}.
+	// It can't be combined with the continuation pattern or the detectors.
+	Start string `yaml:"start,omitempty" json:"start,omitempty"`
+
+	// Continuation is a regular expression matching the lines that continue the event before them, e.g. ^\s
+	Continuation string `yaml:"continuation,omitempty" json:"continuation,omitempty"`
+
+	// Detectors are built-in detectors of stack traces: java, python and go
+	Detectors []string `yaml:"detectors,omitempty" json:"detectors,omitempty"`
+
+	// MaxLines is the maximum number of lines of an event. The lines after it start a new event. Defaults to 500
+	MaxLines int `yaml:"maxLines,omitempty" json:"max_lines,omitempty"`
+}
+
+func (t *MultilineConfig) Validate() error {
+	_, err := t.Compile()
+	return err
+}
+
+// Compile returns the multiline rules of the config.
+func (t *MultilineConfig) Compile() (*Multiline, error) {
+	if t.Start == "" && t.Continuation == "" && len(t.Detectors) == 0 {
+		return nil, fmt.Errorf("multiline requires a start pattern, a continuation pattern or detectors")
+	}
+	if t.Start != "" && (t.Continuation != "" || len(t.Detectors) > 0) {
+		return nil, fmt.Errorf("multiline.start can't be combined with multiline.continuation or multiline.detectors")
+	}
+
+	m := &Multiline{maxLines: t.MaxLines}
+	if m.maxLines <= 0 {
+		m.maxLines = DefaultMultilineMaxLines
+	}
+
+	var err error
+	if t.Start != "" {
+		if m.start, err = regexp.Compile(t.Start); err != nil {
+			return nil, fmt.Errorf("invalid multiline.start %q: %w", t.Start, err)
+		}
+	}
+	if t.Continuation != "" {
+		if m.continuation, err = regexp.Compile(t.Continuation); err != nil {
+			return nil, fmt.Errorf("invalid multiline.continuation %q: %w", t.Continuation, err)
+		}
+	}
+	for _, name := range t.Detectors {
+		detector, ok := multilineDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown multiline detector %q: must be one of java, python or go", name)
+		}
+		m.detectors = append(m.detectors, detector)
+	}
+
+	return m, nil
+}
+
+// Multiline are the compiled rules of a MultilineConfig.
+type Multiline struct {
+	start, continuation *regexp.Regexp
+	detectors           []*regexp.Regexp
+	maxLines            int
+}
+
+// Continues reports whether the line, with its leading whitespace, continues the event before it.
+// A nil Multiline continues no event.
+func (t *Multiline) Continues(line string) bool {
+	if t == nil {
+		return false
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	if t.start != nil {
+		return !t.start.MatchString(line)
+	}
+	if t.continuation != nil && t.continuation.MatchString(line) {
+		return true
+	}
+	if len(t.detectors) > 0 && strings.TrimSpace(line) == "" {
+		return true
+	}
+	for _, detector := range t.detectors {
+		if detector.MatchString(line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MaxLines is the maximum number of lines of an event.
+func (t *Multiline) MaxLines() int {
+	return t.maxLines
+}
+
+// Append appends the continuation line, keeping its indentation, to the message of the event.
+func (t *Multiline) Append(message, line string) string {
+	return message + "\n" + strings.TrimRight(line, " \t\r\n")
+}
+
+// Group folds the continuation lines of the results, in time order, into the result before them.
+// The results keep the time, the labels and the cursor of their first line.
+func (t *Multiline) Group(results []Result) []Result {
+	if t == nil {
+		return results
+	}
+
+	grouped := make([]Result, 0, len(results))
+	lines := 0
+	for _, r := range results {
+		if n := len(grouped); n > 0 && lines < t.maxLines && t.Continues(r.Message) {
+			grouped[n-1].Message = t.Append(grouped[n-1].Message, r.Message)
+			lines++
+			continue
+		}
+
+		grouped = append(grouped, r)
+		lines = 1
+	}
+
+	return grouped
+}
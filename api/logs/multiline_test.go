@@ -0,0 +1,116 @@
+package logs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMultilineGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MultilineConfig
+		lines  []string
+		want   []string
+	}{
+		{
+			name:   "java",
+			config: MultilineConfig{Detectors: []string{MultilineJava}},
+			lines: []string{
+				"ERROR request failed",
+				"java.lang.IllegalStateException: closed",
+				"\tat com.acme.Api.get(Api.java:12)",
+				"Caused by: java.io.IOException: reset",
+				"\t... 3 more",
+				"INFO next request",
+			},
+			want: []string{
+				"ERROR request failed\njava.lang.IllegalStateException: closed\n\tat com.acme.Api.get(Api.java:12)\nCaused by: java.io.IOException: reset\n\t... 3 more",
+				"INFO next request",
+			},
+		},
+		{
+			name:   "python",
+			config: MultilineConfig{Detectors: []string{MultilinePython}},
+			lines: []string{
+				"ERROR:root:lookup failed",
+				"Traceback (most recent call last):",
+				`  File "app.py", line 3, in <module>`,
+				"    users['id']",
+				"KeyError: 'id'",
+				"INFO:root:done",
+			},
+			want: []string{
+				"ERROR:root:lookup failed\nTraceback (most recent call last):\n  File \"app.py\", line 3, in <module>\n    users['id']\nKeyError: 'id'",
+				"INFO:root:done",
+			},
+		},
+		{
+			name:   "go",
+			config: MultilineConfig{Detectors: []string{MultilineGo}},
+			lines: []string{
+				"panic: runtime error: index out of range [1] with length 1",
+				"",
+				"goroutine 1 [running]:",
+				"main.main()",
+				"\t/app/main.go:8 +0x1d",
+				"exit status 2",
+				"starting",
+			},
+			want: []string{
+				"panic: runtime error: index out of range [1] with length 1\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:8 +0x1d\nexit status 2",
+				"starting",
+			},
+		},
+		{
+			name:   "start with max lines",
+			config: MultilineConfig{Start: `^\d{4}-`, MaxLines: 2},
+			lines:  []string{"continued", "2023-03-09 first", "a", "b", "2023-03-09 second"},
+			want:   []string{"continued", "2023-03-09 first\na", "b", "2023-03-09 second"},
+		},
+		{
+			name:   "continuation",
+			config: MultilineConfig{Continuation: `^\s`},
+			lines:  []string{"first", "  second", "third"},
+			want:   []string{"first\n  second", "third"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.config.Compile()
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			var results []Result
+			for _, line := range tt.lines {
+				results = append(results, Result{Time: line, Message: line})
+			}
+
+			var got []string
+			for _, r := range m.Group(results) {
+				if first, _, _ := strings.Cut(r.Message, "\n"); r.Time != first {
+					t.Errorf("Group() time = %q, want the time of the first line %q", r.Time, first)
+				}
+				got = append(got, r.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Group() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultilineConfigValidate(t *testing.T) {
+	for _, config := range []MultilineConfig{
+		{},
+		{Start: "^a", Continuation: "^b"},
+		{Detectors: []string{"ruby"}},
+		{Continuation: "("},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("Validate() expected an error for %+v", config)
+		}
+	}
+}
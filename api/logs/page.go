@@ -0,0 +1,76 @@
+package logs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// pageTokenVersion is bumped whenever the layout of the page token changes
+// so that tokens issued by an older version are rejected instead of misread.
+const pageTokenVersion = 2
+
+// PageToken is the opaque pagination token handed out to the clients.
+//
+// A search can span multiple backends each with its own pagination cursor,
+// so the token wraps the cursor of every backend that still has results to return.
+// Backends that are absent from the token are exhausted and are not queried again.
+type PageToken struct {
+	Version int `json:"v"`
+
+	// Cursors is the page token of each backend keyed by the backend name.
+	// An empty cursor means the backend is to be queried from the start.
+	Cursors map[string]string `json:"c"`
+}
+
+// NewPageToken returns an empty page token of the current version.
+func NewPageToken() *PageToken {
+	return &PageToken{
+		Version: pageTokenVersion,
+		Cursors: make(map[string]string),
+	}
+}
+
+// Encode returns the opaque string representation of the token.
+// An empty string is returned when there are no more pages.
+func (t *PageToken) Encode() (string, error) {
+	if t == nil || len(t.Cursors) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling page token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Has reports whether the given backend has more results to return.
+func (t *PageToken) Has(backend string) bool {
+	_, ok := t.Cursors[backend]
+	return ok
+}
+
+// DecodePageToken parses a token previously returned by Encode.
+func DecodePageToken(token string) (*PageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	var t PageToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	if t.Version != pageTokenVersion {
+		return nil, fmt.Errorf("unsupported page token version %d", t.Version)
+	}
+
+	if t.Cursors == nil {
+		t.Cursors = make(map[string]string)
+	}
+
+	return &t, nil
+}
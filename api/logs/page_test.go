@@ -0,0 +1,41 @@
+package logs
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestPageToken(t *testing.T) {
+	token := NewPageToken()
+	token.Cursors["default/logs/elasticsearch"] = `[1678364951828,"abc"]`
+	token.Cursors["archive"] = ""
+
+	encoded, err := token.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	decoded, err := DecodePageToken(encoded)
+	if err != nil {
+		t.Fatalf("DecodePageToken() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, token) {
+		t.Errorf("DecodePageToken() = %v, want %v", decoded, token)
+	}
+
+	if !decoded.Has("archive") || decoded.Has("default/logs/kubernetes") {
+		t.Errorf("PageToken.Has() returned unexpected results for %v", decoded.Cursors)
+	}
+
+	if encoded, _ := NewPageToken().Encode(); encoded != "" {
+		t.Errorf("Encode() of an empty token = %s, want empty string", encoded)
+	}
+
+	for _, invalid := range []string{"not-base64!", base64.RawURLEncoding.EncodeToString([]byte(`{"v":1,"c":{"0":""}}`))} {
+		if _, err := DecodePageToken(invalid); err == nil {
+			t.Errorf("DecodePageToken(%s) expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeremywohl/flatten"
+)
+
+// Formats of the messages parsed into labels.
+const (
+	ParseFormatJSON   = "json"
+	ParseFormatLogfmt = "logfmt"
+	ParseFormatAuto   = "auto"
+)
+
+// Standard values of the level label.
+const (
+	LevelTrace = "trace"
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+	LevelFatal = "fatal"
+)
+
+// The fields looked up, in order, when the fields of a parse aren't configured.
+var (
+	defaultMessageFields   = []string{"msg", "message", "log"}
+	defaultTimestampFields = []string{"ts", "time", "timestamp", "@timestamp"}
+	defaultLevelFields     = []string{"level", "lvl", "severity", "loglevel"}
+)
+
+// +kubebuilder:object:generate=true
+// ParseConfig parses structured messages into the labels of their results.
+type ParseConfig struct {
+	// Format of the messages: json, logfmt or auto, which detects the format of every message.
+	// Messages that are not in the format are left as they are.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+
+	// MessageField is the field promoted to the message of the result.
+	// Defaults to the first of msg, message and log.
+	MessageField string `yaml:"messageField,omitempty" json:"message_field,omitempty"`
+
+	// TimestampField is the field promoted to the time of the result.
+	// Defaults to the first of ts, time, timestamp and @timestamp.
+	TimestampField string `yaml:"timestampField,omitempty" json:"timestamp_field,omitempty"`
+
+	// LevelField is the field holding the severity, normalised into the level label.
+	// Defaults to the first of level, lvl, severity and loglevel.
+	LevelField string `yaml:"levelField,omitempty" json:"level_field,omitempty"`
+}
+
+func (t *ParseConfig) Validate() error {
+	switch t.Format {
+	case ParseFormatJSON, ParseFormatLogfmt, ParseFormatAuto:
+		return nil
+	case "":
+		return fmt.Errorf("parse.format is required")
+	}
+
+	return fmt.Errorf("unknown parse.format %q: must be one of json, logfmt or auto", t.Format)
+}
+
+// Parse parses the message of the result into labels.
+//
+// The message and timestamp fields are promoted to the message and the time of the result
+// and the severity is normalised into the level label. The labels the result already has are kept.
+func (t *ParseConfig) Parse(r Result) Result {
+	fields := t.parseFields(strings.TrimSpace(r.Message))
+	if len(fields) == 0 {
+		return r
+	}
+
+	if field, ok := lookup(fields, t.MessageField, defaultMessageFields); ok {
+		r.Message = fields[field]
+		delete(fields, field)
+	}
+
+	if field, ok := lookup(fields, t.TimestampField, defaultTimestampFields); ok {
+		if ts, ok := parseFieldTime(fields[field]); ok {
+			r.Time = ts.UTC().Format(time.RFC3339Nano)
+			delete(fields, field)
+		}
+	}
+
+	if field, ok := lookup(fields, t.LevelField, defaultLevelFields); ok {
+		level := NormalizeLevel(fields[field])
+		delete(fields, field)
+		fields[LabelLevel] = level
+	}
+
+	labels := make(map[string]string, len(r.Labels)+len(fields))
+	for k, v := range fields {
+		labels[k] = v
+	}
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	r.Labels = labels
+
+	return r
+}
+
+func (t *ParseConfig) parseFields(message string) map[string]string {
+	format := t.Format
+	if format == ParseFormatAuto {
+		switch {
+		case strings.HasPrefix(message, "{") && strings.HasSuffix(message, "}"):
+			format = ParseFormatJSON
+		case isLogfmt(message):
+			format = ParseFormatLogfmt
+		default:
+			return nil
+		}
+	}
+
+	switch format {
+	case ParseFormatJSON:
+		return parseJSON(message)
+	case ParseFormatLogfmt:
+		return ParseLogfmt(message)
+	}
+
+	return nil
+}
+
+// lookup returns the configured field, or the first of the default fields, that the fields have.
+func lookup(fields map[string]string, configured string, defaults []string) (string, bool) {
+	if configured != "" {
+		_, ok := fields[configured]
+		return configured, ok
+	}
+
+	for _, field := range defaults {
+		if _, ok := fields[field]; ok {
+			return field, true
+		}
+	}
+
+	return "", false
+}
+
+// parseJSON parses a JSON object into fields.
+// Nested fields are joined with dots and the values are stringified.
+func parseJSON(message string) map[string]string {
+	var object map[string]any
+	decoder := json.NewDecoder(bytes.NewReader([]byte(message)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+
+	flattened, err := flatten.Flatten(object, "", flatten.DotStyle)
+	if err != nil {
+		return nil
+	}
+
+	fields := make(map[string]string, len(flattened))
+	for k, v := range flattened {
+		switch v := v.(type) {
+		case nil:
+			fields[k] = ""
+		case string:
+			fields[k] = v
+		default:
+			fields[k] = fmt.Sprint(v)
+		}
+	}
+
+	return fields
+}
+
+// isLogfmt reports whether the message starts with a key=value pair.
+func isLogfmt(message string) bool {
+	eq := strings.IndexByte(message, '=')
+	if eq <= 0 {
+		return false
+	}
+
+	return !strings.ContainsAny(message[:eq], " \t\"")
+}
+
+// ParseLogfmt parses the key=value pairs of a logfmt line.
+// Values may be quoted, and keys without a value are set to an empty value.
+func ParseLogfmt(line string) map[string]string {
+	fields := make(map[string]string)
+	for i := 0; i < len(line); {
+		// Skip the spaces between pairs
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] != '=' {
+			if key != "" {
+				fields[key] = ""
+			}
+			continue
+		}
+		i++ // =
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				end = len(line) - 1
+			}
+			quoted := line[i : end+1]
+			if unquoted, err := strconv.Unquote(quoted); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(quoted, `"`)
+			}
+			i = end + 1
+		} else {
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			value = line[start:i]
+		}
+
+		if key != "" {
+			fields[key] = value
+		}
+	}
+
+	return fields
+}
+
+// parseFieldTime parses a timestamp field: a timestamp in one of the known layouts
+// or the seconds, milliseconds or nanoseconds since the epoch.
+func parseFieldTime(value string) (time.Time, bool) {
+	if t, ok := ParseTimestamp(value); ok {
+		return t, true
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return time.Time{}, false
+	}
+
+	switch {
+	case f > 1e17:
+		return time.Unix(0, int64(f)), true
+	case f > 1e11:
+		return time.UnixMilli(int64(f)), true
+	}
+
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// NormalizeLevel maps the many ways severities are written to the standard levels:
+// trace, debug, info, warn, error and fatal. Unknown levels are returned in lower case.
+func NormalizeLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case "trace", "trc", "t", "finest", "finer":
+		return LevelTrace
+	case "debug", "dbg", "d", "fine", "verbose":
+		return LevelDebug
+	case "info", "inf", "i", "information", "informational", "notice":
+		return LevelInfo
+	case "warn", "warning", "wrn", "w":
+		return LevelWarn
+	case "error", "err", "e", "eror", "severe", "dpanic":
+		return LevelError
+	case "fatal", "ftl", "f", "critical", "crit", "panic", "emerg", "emergency", "alert":
+		return LevelFatal
+	}
+
+	// bunyan and pino write the levels as numbers
+	if n, err := strconv.Atoi(level); err == nil {
+		switch {
+		case n >= 60:
+			return LevelFatal
+		case n >= 50:
+			return LevelError
+		case n >= 40:
+			return LevelWarn
+		case n >= 30:
+			return LevelInfo
+		case n >= 20:
+			return LevelDebug
+		case n >= 10:
+			return LevelTrace
+		}
+	}
+
+	return level
+}
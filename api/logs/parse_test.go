@@ -0,0 +1,96 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ParseConfig
+		in     Result
+		want   Result
+	}{
+		{
+			name:   "json",
+			config: ParseConfig{Format: ParseFormatJSON},
+			in: Result{
+				Message: `{"ts":"2023-03-09T12:29:11.5Z","level":"WARNING","msg":"slow request","http":{"status":504},"pod":"ignored"}`,
+				Labels:  map[string]string{"pod": "api-1"},
+			},
+			want: Result{
+				Time:    "2023-03-09T12:29:11.5Z",
+				Message: "slow request",
+				Labels:  map[string]string{"pod": "api-1", "level": "warn", "http.status": "504"},
+			},
+		},
+		{
+			name:   "logfmt",
+			config: ParseConfig{Format: ParseFormatAuto},
+			in:     Result{Time: "2023-03-09T00:00:00Z", Message: `time=1678364951 lvl=eror msg="connection \"refused\"" retry`},
+			want: Result{
+				Time:    "2023-03-09T12:29:11Z",
+				Message: `connection "refused"`,
+				Labels:  map[string]string{"level": "error", "retry": ""},
+			},
+		},
+		{
+			name:   "configured fields",
+			config: ParseConfig{Format: ParseFormatAuto, MessageField: "event", TimestampField: "at", LevelField: "sev"},
+			in:     Result{Message: `{"event":"started","at":1678364951123,"sev":30,"msg":"kept"}`},
+			want: Result{
+				Time:    "2023-03-09T12:29:11.123Z",
+				Message: "started",
+				Labels:  map[string]string{"level": "info", "msg": "kept"},
+			},
+		},
+		{
+			name:   "plain text",
+			config: ParseConfig{Format: ParseFormatAuto},
+			in:     Result{Message: "GET /healthz 200 took=3ms"},
+			want:   Result{Message: "GET /healthz 200 took=3ms"},
+		},
+		{
+			name:   "not json",
+			config: ParseConfig{Format: ParseFormatJSON},
+			in:     Result{Message: "{not json}"},
+			want:   Result{Message: "{not json}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.Parse(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLevel(t *testing.T) {
+	tests := map[string]string{
+		"INFO":     LevelInfo,
+		"Warning":  LevelWarn,
+		"E":        LevelError,
+		"critical": LevelFatal,
+		"20":       LevelDebug,
+		"10":       LevelTrace,
+		"audit":    "audit",
+	}
+
+	for in, want := range tests {
+		if got := NormalizeLevel(in); got != want {
+			t.Errorf("NormalizeLevel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseConfigValidate(t *testing.T) {
+	if err := (&ParseConfig{Format: "xml"}).Validate(); err == nil {
+		t.Errorf("Validate() expected an error for an unknown format")
+	}
+	if err := (&ParseConfig{Format: ParseFormatLogfmt}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package logs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// +kubebuilder:object:generate=true
+// SearchRewrite rewrites a search before it reaches the backend of a route.
+//
+// The rewrite is applied in order: the id prefix is stripped, the defaults
+// are set, the search is fanned out and finally the label keys are renamed.
+type SearchRewrite struct {
+	// StripIdPrefix is removed from the start of the id of the search, e.g. cluster-main/
+	StripIdPrefix string `yaml:"stripIdPrefix,omitempty" json:"strip_id_prefix,omitempty"`
+
+	// Defaults are set on the search when it doesn't already set them
+	Defaults *SearchDefaults `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+
+	// FanOut runs the search once for every value of a label
+	FanOut *SearchFanOut `yaml:"fanOut,omitempty" json:"fan_out,omitempty"`
+
+	// Labels renames the label keys of the search, e.g. pod: kubernetes.pod.name
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// SearchDefaults are the backend specific defaults of a search.
+type SearchDefaults struct {
+	// Labels are added to the search when it doesn't have a label with the same key
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// Query is used when the search has no query
+	Query string `yaml:"query,omitempty" json:"query,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// SearchFanOut splits a search into one search per value of a label.
+type SearchFanOut struct {
+	// Label is the key of the label whose values the search is fanned out on
+	Label string `yaml:"label" json:"label"`
+	// Values are used when the search doesn't set the label.
+	// A search that sets the label is fanned out on its comma separated values.
+	Values []string `yaml:"values,omitempty" json:"values,omitempty"`
+}
+
+// MapSearchParams implements SearchMapper.
+func (t *SearchRewrite) MapSearchParams(p *SearchParams) ([]SearchParams, error) {
+	q := p.Clone()
+	if t.StripIdPrefix != "" {
+		q.Id = strings.TrimPrefix(q.Id, t.StripIdPrefix)
+	}
+
+	if t.Defaults != nil {
+		for k, v := range t.Defaults.Labels {
+			if _, ok := q.Labels[k]; !ok {
+				if q.Labels == nil {
+					q.Labels = make(map[string]string)
+				}
+				q.Labels[k] = v
+			}
+		}
+
+		if q.Query == "" {
+			q.Query = t.Defaults.Query
+		}
+	}
+
+	queries := []SearchParams{*q}
+	if t.FanOut != nil {
+		var err error
+		if queries, err = t.FanOut.fanOut(q); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range queries {
+		queries[i].Labels = t.renameLabels(queries[i].Labels)
+	}
+
+	return queries, nil
+}
+
+func (t *SearchFanOut) fanOut(q *SearchParams) ([]SearchParams, error) {
+	values := t.Values
+	if v, ok := q.Labels[t.Label]; ok {
+		values = strings.Split(v, ",")
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values to fan the search out on label %q", t.Label)
+	}
+
+	queries := make([]SearchParams, 0, len(values))
+	for _, value := range values {
+		fanned := q.Clone()
+		if fanned.Labels == nil {
+			fanned.Labels = make(map[string]string)
+		}
+		fanned.Labels[t.Label] = strings.TrimSpace(value)
+		queries = append(queries, *fanned)
+	}
+
+	return queries, nil
+}
+
+func (t *SearchRewrite) renameLabels(labels map[string]string) map[string]string {
+	if len(t.Labels) == 0 || len(labels) == 0 {
+		return labels
+	}
+
+	renamed := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if to, ok := t.Labels[k]; ok {
+			k = to
+		}
+		renamed[k] = v
+	}
+
+	return renamed
+}
+
+// Validate checks that the fan out has a label to fan out on.
+func (t *SearchRewrite) Validate() error {
+	if t.FanOut != nil && t.FanOut.Label == "" {
+		return fmt.Errorf("rewrite fanOut requires a label")
+	}
+
+	return nil
+}
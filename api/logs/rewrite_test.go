@@ -0,0 +1,81 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchRewrite_MapSearchParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite SearchRewrite
+		args    SearchParams
+		want    []SearchParams
+		wantErr bool
+	}{
+		{
+			name:    "rename labels",
+			rewrite: SearchRewrite{Labels: map[string]string{"pod": "kubernetes.pod.name"}},
+			args:    SearchParams{Labels: map[string]string{"pod": "nginx", "app": "web"}},
+			want:    []SearchParams{{Labels: map[string]string{"kubernetes.pod.name": "nginx", "app": "web"}}},
+		},
+		{
+			name:    "strip id prefix",
+			rewrite: SearchRewrite{StripIdPrefix: "cluster-main/"},
+			args:    SearchParams{Id: "cluster-main/nginx"},
+			want:    []SearchParams{{Id: "nginx"}},
+		},
+		{
+			name: "defaults",
+			rewrite: SearchRewrite{Defaults: &SearchDefaults{
+				Labels: map[string]string{"namespace": "default", "app": "api"},
+				Query:  "level:error",
+			}},
+			args: SearchParams{Labels: map[string]string{"app": "web"}},
+			want: []SearchParams{{Query: "level:error", Labels: map[string]string{"namespace": "default", "app": "web"}}},
+		},
+		{
+			name: "fan out on configured values",
+			rewrite: SearchRewrite{
+				FanOut: &SearchFanOut{Label: "namespace", Values: []string{"default", "kube-system"}},
+				Labels: map[string]string{"namespace": "kubernetes.namespace"},
+			},
+			args: SearchParams{Id: "nginx"},
+			want: []SearchParams{
+				{Id: "nginx", Labels: map[string]string{"kubernetes.namespace": "default"}},
+				{Id: "nginx", Labels: map[string]string{"kubernetes.namespace": "kube-system"}},
+			},
+		},
+		{
+			name:    "fan out on search values",
+			rewrite: SearchRewrite{FanOut: &SearchFanOut{Label: "namespace", Values: []string{"default"}}},
+			args:    SearchParams{Labels: map[string]string{"namespace": "a, b"}},
+			want: []SearchParams{
+				{Labels: map[string]string{"namespace": "a"}},
+				{Labels: map[string]string{"namespace": "b"}},
+			},
+		},
+		{
+			name:    "fan out without values",
+			rewrite: SearchRewrite{FanOut: &SearchFanOut{Label: "namespace"}},
+			args:    SearchParams{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args.Clone()
+			got, err := tt.rewrite.MapSearchParams(args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MapSearchParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MapSearchParams() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(*args, tt.args) {
+				t.Errorf("MapSearchParams() modified the search to %v", *args)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package logs
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	durationUtil "github.com/flanksource/commons/duration"
+)
+
+// regexCache holds the compiled route patterns,
+// as routes are matched against every search.
+var regexCache sync.Map
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if cached, ok := regexCache.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCache.Store(expr, re)
+	return re, nil
+}
+
+func matchRegex(expr, value string) bool {
+	re, err := compileRegex(expr)
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(value)
+}
+
+// matchGlob matches the value against a glob pattern
+// where * matches any sequence of characters and ? matches a single character.
+func matchGlob(pattern, value string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == value
+	}
+
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return matchRegex("^"+expr+"$", value)
+}
+
+// ageToTime returns the point in time the given age (e.g. 7d) refers to.
+func ageToTime(age string) time.Time {
+	d, err := durationUtil.ParseDuration(age)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Now().Add(-time.Duration(d))
+}
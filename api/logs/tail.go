@@ -0,0 +1,25 @@
+package logs
+
+import "context"
+
+// +kubebuilder:object:generate=false
+// Tailer is implemented by the backends that can stream
+// the log lines of a search as they are written.
+//
+// Backends that don't implement it are tailed by polling their search.
+type Tailer interface {
+	// Tail sends the results of the search to the channel as they are written
+	// until the context is done. Sending blocks until the result is consumed
+	// or the context is done.
+	Tail(ctx context.Context, q *SearchParams, results chan<- Result) error
+}
+
+// TailEvent is an event of a tail stream.
+// It holds either a result or the error that stopped a backend.
+type TailEvent struct {
+	Result *Result `json:"result,omitempty"`
+
+	// Backend and Error are set when tailing the backend failed
+	Backend string `json:"backend,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
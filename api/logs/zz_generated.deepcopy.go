@@ -84,6 +84,18 @@ func (in *CommonBackend) DeepCopyInto(out *CommonBackend) {
 			(*out)[key] = val
 		}
 	}
+	if in.LabelMapping != nil {
+		in, out := &in.LabelMapping, &out.LabelMapping
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Parse != nil {
+		in, out := &in.Parse, &out.Parse
+		*out = new(ParseConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommonBackend.
@@ -153,6 +165,36 @@ func (in *ElasticSearchFields) DeepCopy() *ElasticSearchFields {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileIndex) DeepCopyInto(out *FileIndex) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileIndex.
+func (in *FileIndex) DeepCopy() *FileIndex {
+	if in == nil {
+		return nil
+	}
+	out := new(FileIndex)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileParser) DeepCopyInto(out *FileParser) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileParser.
+func (in *FileParser) DeepCopy() *FileParser {
+	if in == nil {
+		return nil
+	}
+	out := new(FileParser)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FileSearchBackendConfig) DeepCopyInto(out *FileSearchBackendConfig) {
 	*out = *in
@@ -162,6 +204,26 @@ func (in *FileSearchBackendConfig) DeepCopyInto(out *FileSearchBackendConfig) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Parser != nil {
+		in, out := &in.Parser, &out.Parser
+		*out = new(FileParser)
+		**out = **in
+	}
+	if in.Index != nil {
+		in, out := &in.Index, &out.Index
+		*out = new(FileIndex)
+		**out = **in
+	}
+	if in.Multiline != nil {
+		in, out := &in.Multiline, &out.Multiline
+		*out = new(MultilineConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHConnection)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileSearchBackendConfig.
@@ -183,6 +245,11 @@ func (in *KubernetesSearchBackendConfig) DeepCopyInto(out *KubernetesSearchBacke
 		*out = new(kommons.EnvVar)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Multiline != nil {
+		in, out := &in.Multiline, &out.Multiline
+		*out = new(MultilineConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesSearchBackendConfig.
@@ -195,6 +262,26 @@ func (in *KubernetesSearchBackendConfig) DeepCopy() *KubernetesSearchBackendConf
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MultilineConfig) DeepCopyInto(out *MultilineConfig) {
+	*out = *in
+	if in.Detectors != nil {
+		in, out := &in.Detectors, &out.Detectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MultilineConfig.
+func (in *MultilineConfig) DeepCopy() *MultilineConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MultilineConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenSearchBackendConfig) DeepCopyInto(out *OpenSearchBackendConfig) {
 	*out = *in
@@ -222,6 +309,66 @@ func (in *OpenSearchBackendConfig) DeepCopy() *OpenSearchBackendConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParseConfig) DeepCopyInto(out *ParseConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParseConfig.
+func (in *ParseConfig) DeepCopy() *ParseConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ParseConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHConnection) DeepCopyInto(out *SSHConnection) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Username != nil {
+		in, out := &in.Username, &out.Username
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PrivateKey != nil {
+		in, out := &in.PrivateKey, &out.PrivateKey
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Passphrase != nil {
+		in, out := &in.Passphrase, &out.Passphrase
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostKeys != nil {
+		in, out := &in.HostKeys, &out.HostKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHConnection.
+func (in *SSHConnection) DeepCopy() *SSHConnection {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHConnection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SearchBackendConfig) DeepCopyInto(out *SearchBackendConfig) {
 	*out = *in
@@ -262,6 +409,80 @@ func (in *SearchBackendConfig) DeepCopy() *SearchBackendConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchDefaults) DeepCopyInto(out *SearchDefaults) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchDefaults.
+func (in *SearchDefaults) DeepCopy() *SearchDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchFanOut) DeepCopyInto(out *SearchFanOut) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchFanOut.
+func (in *SearchFanOut) DeepCopy() *SearchFanOut {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchFanOut)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRewrite) DeepCopyInto(out *SearchRewrite) {
+	*out = *in
+	if in.Defaults != nil {
+		in, out := &in.Defaults, &out.Defaults
+		*out = new(SearchDefaults)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FanOut != nil {
+		in, out := &in.FanOut, &out.FanOut
+		*out = new(SearchFanOut)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRewrite.
+func (in *SearchRewrite) DeepCopy() *SearchRewrite {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRewrite)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SearchRoute) DeepCopyInto(out *SearchRoute) {
 	*out = *in
@@ -272,6 +493,16 @@ func (in *SearchRoute) DeepCopyInto(out *SearchRoute) {
 			(*out)[key] = val
 		}
 	}
+	if in.Fallbacks != nil {
+		in, out := &in.Fallbacks, &out.Fallbacks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rewrite != nil {
+		in, out := &in.Rewrite, &out.Rewrite
+		*out = new(SearchRewrite)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRoute.
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"os"
+	"time"
 
 	"github.com/flanksource/apm-hub/db"
+	"github.com/flanksource/apm-hub/pkg"
 	"github.com/flanksource/commons/logger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -22,6 +24,11 @@ var metricsPort int
 func ServerFlags(flags *pflag.FlagSet) {
 	flags.IntVar(&httpPort, "httpPort", 8080, "Port to expose the http server")
 	flags.IntVar(&metricsPort, "metricsPort", 8081, "Port to expose a health dashboard")
+	flags.DurationVar(&pkg.DefaultBackendTimeout, "backend-timeout", 30*time.Second, "Default timeout of a search against a single backend")
+	flags.DurationVar(&pkg.TailPollInterval, "tail-poll-interval", 5*time.Second, "How often the backends that cannot stream are searched for new results when tailing")
+	flags.DurationVar(&pkg.TailHeartbeatInterval, "tail-heartbeat-interval", 15*time.Second, "How often a heartbeat is sent on idle tail streams")
+	flags.IntVar(&pkg.TailPollFailures, "tail-poll-failures", 3, "Number of polls in a row that can fail before the tail of a backend that cannot stream fails")
+	flags.DurationVar(&pkg.LabelsCacheTTL, "labels-cache-ttl", 5*time.Minute, "How long the labels discovered on the backends are cached")
 }
 
 func readFromEnv(v string) string {
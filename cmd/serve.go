@@ -76,6 +76,11 @@ func SetupServer(kClient *kommons.Client) *echo.Echo {
 	})
 
 	e.POST("/search", pkg.Search)
+	e.POST("/search/explain", pkg.Explain)
+	e.POST("/search/tail", pkg.Tail)
+	e.POST("/search/histogram", pkg.Histogram)
+	e.GET("/labels", pkg.Labels)
+	e.GET("/labels/:label/values", pkg.LabelValues)
 
 	return e
 }
@@ -53,7 +53,7 @@ func DeleteLoggingBackend(id string) error {
 
 func GetLoggingBackendsSpecs() ([]logs.SearchBackendConfig, error) {
 	var dbBackends []models.LoggingBackend
-	err := gormDB.Table("logging_backends").Where("deleted_at IS NULL").Find(&dbBackends).Error
+	err := gormDB.Table("logging_backends").Where("deleted_at IS NULL").Order("name").Find(&dbBackends).Error
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +67,10 @@ func GetLoggingBackendsSpecs() ([]logs.SearchBackendConfig, error) {
 			continue
 		}
 
-		backends = append(backends, spec.Backends...)
+		for _, backend := range spec.Backends {
+			backend.Source = dbBackend.Name
+			backends = append(backends, backend)
+		}
 	}
 
 	return backends, nil
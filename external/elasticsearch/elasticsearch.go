@@ -1,6 +1,7 @@
 package elasticsearch
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/flanksource/apm-hub/api/logs"
@@ -25,6 +26,10 @@ type SearchResponse struct {
 	Took     float64 `json:"took"`
 	TimedOut bool    `json:"timed_out"`
 	Hits     HitsInfo
+
+	// Aggregations holds the aggregations of the search, keyed by their name.
+	// They are decoded by their consumers, e.g. Facets.
+	Aggregations map[string]json.RawMessage `json:"aggregations,omitempty"`
 }
 
 type SearchHit struct {
@@ -60,7 +65,8 @@ func (t *HitsInfo) NextPage(requestedRowsCount int) string {
 }
 
 // GetResultsFromHits returns the results from the hits.
-func (t *HitsInfo) GetResultsFromHits(requestedRowsCount int64, msgField, timestampField string, labelsToAttach map[string]string, excludeFields ...string) []logs.Result {
+// The fields of the source are mapped to the canonical labels with the label mapping.
+func (t *HitsInfo) GetResultsFromHits(requestedRowsCount int64, msgField, timestampField string, labelsToAttach map[string]string, mapping logs.LabelMapping, excludeFields ...string) []logs.Result {
 	// Don't user more than the requested rows count.
 	rows := t.Hits
 	if len(t.Hits) > int(requestedRowsCount) {
@@ -86,12 +92,24 @@ func (t *HitsInfo) GetResultsFromHits(requestedRowsCount int64, msgField, timest
 			logger.Errorf("error extracting labels: %v", err)
 		}
 
+		var cursor string
+		if len(row.Sort) > 0 {
+			if cursor, err = utils.Stringify(row.Sort); err != nil {
+				logger.Debugf("error stringifying sort: %v", err)
+			}
+		}
+
+		resultLabels := make(map[string]string, len(labelsToAttach)+len(labels))
+		collections.MergeMap(resultLabels, labelsToAttach)
+		collections.MergeMap(resultLabels, mapping.ToCanonical(labels))
+
 		var timestamp, _ = row.Source[timestampField].(string)
 		resp = append(resp, logs.Result{
 			Id:      row.ID,
 			Message: msg,
 			Time:    timestamp,
-			Labels:  collections.MergeMap(labelsToAttach, labels),
+			Labels:  resultLabels,
+			Cursor:  cursor,
 		})
 	}
 
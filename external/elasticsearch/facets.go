@@ -0,0 +1,88 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// facetPrefix prefixes the names of the aggregations of the facets.
+const facetPrefix = "facet:"
+
+// TermsAggregation is the result of a terms aggregation.
+type TermsAggregation struct {
+	Buckets []struct {
+		Key      any   `json:"key"`
+		DocCount int64 `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+// AddFacetsToBody adds a terms aggregation of the field of every facet to the body of a search.
+// The fields are keyed by the label of their facet.
+func AddFacetsToBody(body string, fields map[string]string, size int) (string, error) {
+	search, err := decodeBody(body)
+	if err != nil {
+		return "", err
+	}
+
+	aggs, _ := search["aggs"].(map[string]any)
+	if aggs == nil {
+		aggs = make(map[string]any, len(fields))
+	}
+	for label, field := range fields {
+		aggs[facetPrefix+label] = map[string]any{"terms": map[string]any{"field": field, "size": size}}
+	}
+	search["aggs"] = aggs
+
+	out, err := json.Marshal(search)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Facets returns the values counted by the aggregations of the facets of the labels.
+// Only the aggregations of the facets are decoded, the query template can add aggregations of any kind.
+func (t SearchResponse) Facets(labels []string) (logs.Facets, error) {
+	var facets logs.Facets
+	for _, label := range labels {
+		raw, ok := t.Aggregations[facetPrefix+label]
+		if !ok {
+			continue
+		}
+
+		var aggregation TermsAggregation
+		if err := json.Unmarshal(raw, &aggregation); err != nil {
+			return nil, fmt.Errorf("error parsing the aggregation of the facet %q: %w", label, err)
+		}
+
+		values := make([]logs.FacetValue, 0, len(aggregation.Buckets))
+		for _, b := range aggregation.Buckets {
+			values = append(values, logs.FacetValue{Value: fmt.Sprint(b.Key), Count: b.DocCount})
+		}
+		if facets == nil {
+			facets = make(logs.Facets)
+		}
+		facets[label] = values
+	}
+
+	return facets, nil
+}
+
+// decodeBody decodes the rendered body of a search,
+// keeping the precision of large numbers, e.g. in search_after.
+func decodeBody(body string) (map[string]any, error) {
+	var search map[string]any
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&search); err != nil {
+		return nil, fmt.Errorf("error parsing the rendered query: %w", err)
+	}
+	if search == nil {
+		search = make(map[string]any)
+	}
+
+	return search, nil
+}
@@ -0,0 +1,36 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestSearchResponseFacets(t *testing.T) {
+	body := `{
+		"hits": {"hits": []},
+		"aggregations": {
+			"facet:level": {"buckets": [{"key": "error", "doc_count": 3}, {"key": "info", "doc_count": 1}]},
+			"facet:pod": {"buckets": [{"key": "api-1", "doc_count": 4}]},
+			"latency": {"value": 12.5},
+			"per_day": {"buckets": {"monday": {"doc_count": 1}}}
+		}
+	}`
+
+	var r SearchResponse
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatalf("error decoding the response: %v", err)
+	}
+
+	got, err := r.Facets([]string{"level", "namespace"})
+	if err != nil {
+		t.Fatalf("Facets() error = %v", err)
+	}
+
+	want := logs.Facets{"level": {{Value: "error", Count: 3}, {Value: "info", Count: 1}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Facets() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// maxHistogramGroups is the maximum number of groups of a histogram, the most frequent ones are kept.
+const maxHistogramGroups = 100
+
+// HistogramBody turns the body of a search into the aggregation of its hits
+// in buckets of the interval, broken down by the values of the group field when set.
+func HistogramBody(body string, timestampField string, interval time.Duration, groupField string) (string, error) {
+	search, err := decodeBody(body)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the aggregation is returned
+	for _, key := range []string{"sort", "search_after", "from", "_source", "aggs", "aggregations"} {
+		delete(search, key)
+	}
+	search["size"] = 0
+
+	histogram := map[string]any{
+		"date_histogram": map[string]any{
+			"field":          timestampField,
+			"fixed_interval": fmt.Sprintf("%dms", interval.Milliseconds()),
+			"min_doc_count":  1,
+		},
+	}
+	if groupField == "" {
+		search["aggs"] = map[string]any{"histogram": histogram}
+	} else {
+		search["aggs"] = map[string]any{
+			"groups": map[string]any{
+				"terms": map[string]any{"field": groupField, "size": maxHistogramGroups},
+				"aggs":  map[string]any{"histogram": histogram},
+			},
+		}
+	}
+
+	out, err := json.Marshal(search)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// HistogramResponse is the response to a search made with a HistogramBody.
+type HistogramResponse struct {
+	Aggregations struct {
+		Histogram HistogramAggregation `json:"histogram"`
+		Groups    struct {
+			Buckets []struct {
+				Key       any                  `json:"key"`
+				Histogram HistogramAggregation `json:"histogram"`
+			} `json:"buckets"`
+		} `json:"groups"`
+	} `json:"aggregations"`
+}
+
+type HistogramAggregation struct {
+	Buckets []struct {
+		// Key is the start of the bucket in milliseconds since the epoch
+		Key      int64 `json:"key"`
+		DocCount int64 `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+func (t HistogramAggregation) series(group string) logs.HistogramSeries {
+	series := logs.HistogramSeries{Group: group, Buckets: make([]logs.HistogramBucket, 0, len(t.Buckets))}
+	for _, b := range t.Buckets {
+		series.Buckets = append(series.Buckets, logs.HistogramBucket{
+			Time:  time.UnixMilli(b.Key).UTC().Format(time.RFC3339Nano),
+			Count: b.DocCount,
+		})
+	}
+	return series
+}
+
+// Series returns the counts of the response, one series per group.
+func (t HistogramResponse) Series(grouped bool) []logs.HistogramSeries {
+	if !grouped {
+		return []logs.HistogramSeries{t.Aggregations.Histogram.series("")}
+	}
+
+	series := make([]logs.HistogramSeries, 0, len(t.Aggregations.Groups.Buckets))
+	for _, group := range t.Aggregations.Groups.Buckets {
+		series = append(series, group.Histogram.series(fmt.Sprint(group.Key)))
+	}
+	return series
+}
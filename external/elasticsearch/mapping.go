@@ -0,0 +1,53 @@
+package elasticsearch
+
+import (
+	"sort"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+)
+
+// MappingResponse is the response of the mapping API keyed by index.
+type MappingResponse map[string]struct {
+	Mappings struct {
+		Properties map[string]MappingProperty `json:"properties"`
+	} `json:"mappings"`
+}
+
+// MappingProperty is a field of an index, or an object holding more fields.
+type MappingProperty struct {
+	Type       string                     `json:"type"`
+	Properties map[string]MappingProperty `json:"properties"`
+}
+
+// LabelKeys returns the canonical keys of the fields of every index
+// except for the message, the timestamp and the excluded fields.
+// The names of the fields of objects are joined with dots, like the labels of the results.
+func (t MappingResponse) LabelKeys(fields logs.ElasticSearchFields, mapping logs.LabelMapping) []string {
+	seen := make(map[string]bool)
+	var walk func(prefix string, properties map[string]MappingProperty)
+	walk = func(prefix string, properties map[string]MappingProperty) {
+		for name, property := range properties {
+			field := prefix + name
+			if len(property.Properties) > 0 {
+				walk(field+".", property.Properties)
+				continue
+			}
+			if field == fields.Message || field == fields.Timestamp || collections.Contains(fields.Exclusions, field) {
+				continue
+			}
+			seen[mapping.Canonical(field)] = true
+		}
+	}
+
+	for _, index := range t {
+		walk("", index.Mappings.Properties)
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+)
+
+// Template renders the searches of the query template of a backend and reads the results of their responses.
+// It is shared by the Elasticsearch and the OpenSearch backends, which only differ by their client.
+type Template struct {
+	query    string
+	template *template.Template
+	fields   logs.ElasticSearchFields
+	mapping  logs.LabelMapping
+
+	// labels are the labels of the backend attached to every result
+	labels map[string]string
+}
+
+// NewTemplate parses the query template of a backend with the fields and the labels of the backend.
+func NewTemplate(queryTemplate string, fields logs.ElasticSearchFields, mapping logs.LabelMapping, labels map[string]string) (*Template, error) {
+	tmpl, err := template.New("query").Parse(queryTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+
+	return &Template{
+		query:    queryTemplate,
+		template: tmpl,
+		fields:   fields,
+		mapping:  mapping,
+		labels:   labels,
+	}, nil
+}
+
+// Capabilities of the backends of a query template. The query template bounds the search
+// and the query is translated to the query DSL.
+func (t *Template) Capabilities() logs.Capabilities {
+	return logs.Capabilities{TimeRange: true, Query: true, Labels: true, Limit: true, Page: true, Facets: true}
+}
+
+// RenderQuery renders the query template with the search params.
+// The labels of the search are in .Labels, and in .NativeLabels with the canonical
+// labels translated to the fields of the index.
+//
+// The query of the search is translated to the query DSL and added as a filter
+// to the rendered query, unless the template refers to the query itself.
+// A terms aggregation of the field of every facet of the search is added to the rendered query.
+func (t *Template) RenderQuery(q *logs.SearchParams) (string, error) {
+	data, err := query.NewElasticsearchTemplate(q, query.ElasticsearchFields{
+		Message:   t.fields.Message,
+		Timestamp: t.fields.Timestamp,
+		Labels:    t.mapping,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error executing template: %w", err)
+	}
+
+	body := buf.String()
+	if q.Query != "" && !strings.Contains(t.query, ".Query") {
+		if body, err = query.AddToElasticsearchBody(body, data.QueryDSL); err != nil {
+			return "", err
+		}
+	}
+
+	if len(q.Facets) == 0 {
+		return body, nil
+	}
+
+	fields := make(map[string]string, len(q.Facets))
+	for _, label := range q.Facets {
+		fields[label] = t.mapping.Native(label)
+	}
+	return AddFacetsToBody(body, fields, q.GetFacetLimit())
+}
+
+// SearchResults returns the results, and the facets, of the response to the search.
+func (t *Template) SearchResults(q *logs.SearchParams, r SearchResponse) (logs.SearchResults, error) {
+	var result logs.SearchResults
+	result.Results = r.Hits.GetResultsFromHits(q.Limit, t.fields.Message, t.fields.Timestamp, t.labels, t.mapping, t.fields.Exclusions...)
+	result.Total = int(r.Hits.Total.Value)
+	result.NextPage = r.Hits.NextPage(int(q.Limit))
+
+	var err error
+	result.Facets, err = r.Facets(q.Facets)
+	return result, err
+}
+
+// RenderHistogram renders the body that counts the hits of the search with a date histogram aggregation,
+// nested in a terms aggregation on the field of the GroupBy label when set, and reports whether it's nested.
+func (t *Template) RenderHistogram(q *logs.HistogramParams, interval time.Duration) (string, bool, error) {
+	body, err := t.RenderQuery(&q.SearchParams)
+	if err != nil {
+		return "", false, err
+	}
+
+	var groupField string
+	if q.GroupBy != "" {
+		groupField = t.mapping.Native(q.GroupBy)
+	}
+
+	body, err = HistogramBody(body, t.fields.Timestamp, interval, groupField)
+	return body, groupField != "", err
+}
+
+// LabelKeys returns the canonical keys of the fields of the mapping that are labels of the results.
+func (t *Template) LabelKeys(mapping MappingResponse) []string {
+	return mapping.LabelKeys(t.fields, t.mapping)
+}
@@ -0,0 +1,61 @@
+package cloudwatch
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// maxLabelValues is the number of values of a label, the most frequent ones, that are discovered.
+const maxLabelValues = 100
+
+// LabelKeys returns the fields discovered in the log group and the labels of the backend.
+func (t *cloudWatchSearch) LabelKeys(ctx context.Context) ([]string, error) {
+	output, err := t.client.GetLogGroupFields(ctx, &cloudwatchlogs.GetLogGroupFieldsInput{
+		LogGroupName: &t.config.LogGroup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(output.LogGroupFields))
+	for _, field := range output.LogGroupFields {
+		switch name := deref(field.Name); name {
+		case "@message", "@timestamp", "@ptr":
+		default:
+			keys = append(keys, t.labels.Canonical(name))
+		}
+	}
+	sort.Strings(keys)
+
+	return append(keys, t.config.LabelKeys()...), nil
+}
+
+// LabelValues returns the most frequent values of the field of the label
+// in the events of the configured query over the default time range of a search.
+func (t *cloudWatchSearch) LabelValues(ctx context.Context, label string) ([]string, error) {
+	if value, ok := t.config.Labels[label]; ok {
+		return []string{value}, nil
+	}
+
+	q := &logs.SearchParams{Facets: []string{label}, FacetLimit: maxLabelValues}
+	q.SetDefaults()
+
+	query, err := t.RenderQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	facets, err := t.facets(ctx, q, query)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(facets[label]))
+	for _, v := range facets[label] {
+		values = append(values, v.Value)
+	}
+	return values, nil
+}
@@ -2,64 +2,117 @@ package cloudwatch
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/flanksource/commons/logger"
 )
 
 func NewCloudWatchSearchBackend(config *logs.CloudWatchBackendConfig, client *cloudwatchlogs.Client) *cloudWatchSearch {
 	return &cloudWatchSearch{
 		client: client,
 		config: config,
+		labels: config.GetLabelMapping(logs.BackendTypeCloudWatch),
 	}
 }
 
 type cloudWatchSearch struct {
 	client *cloudwatchlogs.Client
 	config *logs.CloudWatchBackendConfig
+	labels logs.LabelMapping
 }
 
-func (t *cloudWatchSearch) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
-	return t.config.CommonBackend.Routes.MatchRoute(q)
-}
+// RenderQuery returns the Insights query of the search.
+//
+// The labels and the query of the search are translated into a filter, prepended to the configured query.
+// Labels are filtered on their mapped fields, or on the fields of the same name when they have no mapping.
+// The configured labels of the backend aren't fields of its events, so they are matched here instead.
+func (t *cloudWatchSearch) RenderQuery(q *logs.SearchParams) (string, error) {
+	var filters []string
+	for _, key := range sortedKeys(q.Labels) {
+		if value, ok := t.config.Labels[key]; ok {
+			if !newLabelFilter(q.Labels[key]).match(value) {
+				filters = append(filters, "1 = 0")
+			}
+			continue
+		}
+		filters = append(filters, newLabelFilter(q.Labels[key]).render(t.labels.Native(key)))
+	}
 
-func (t *cloudWatchSearch) Search(q *logs.SearchParams) (logs.SearchResults, error) {
-	logFilter := &cloudwatchlogs.StartQueryInput{
-		LogGroupName: &t.config.LogGroup,
-		Limit:        ptr(int32(q.Limit)),
-		QueryString:  &t.config.Query,
+	node, err := query.Parse(q.Query)
+	if err != nil {
+		return "", err
+	}
+	if node != nil {
+		filters = append(filters, query.ToCloudWatch(node, t.labels))
 	}
 
-	if q.GetStart() != nil {
-		logFilter.StartTime = ptr(q.GetStart().UnixMilli())
+	if len(filters) == 0 {
+		return t.config.Query, nil
 	}
 
-	if q.GetEnd() != nil {
-		logFilter.EndTime = ptr(q.GetEnd().UnixMilli())
-	} else {
-		logFilter.EndTime = ptr(time.Now().UnixMilli()) // end time is a required field
+	filter := "filter " + strings.Join(filters, " and ")
+	if t.config.Query == "" {
+		return filter, nil
 	}
 
-	var result logs.SearchResults
-	queryOutput, err := t.client.StartQuery(context.Background(), logFilter)
+	return filter + " | " + t.config.Query, nil
+}
+
+// Capabilities of CloudWatch. Logs Insights queries are not paginated,
+// so pages are offsets into the results.
+func (t *cloudWatchSearch) Capabilities() logs.Capabilities {
+	return logs.Capabilities{TimeRange: true, Query: true, Labels: true, Limit: true, Facets: true}
+}
+
+func (t *cloudWatchSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	query, err := t.RenderQuery(q)
 	if err != nil {
-		return result, err
+		return logs.SearchResults{}, err
+	}
+
+	// The facets are counted by their own queries, run alongside the search
+	var facets logs.Facets
+	var facetsErr error
+	var wg sync.WaitGroup
+	if len(q.Facets) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			facets, facetsErr = t.facets(ctx, q, query)
+		}()
 	}
 
-	queryResult, err := t.getQueryResults(queryOutput.QueryId)
+	var result logs.SearchResults
+	queryResult, err := t.runQuery(ctx, q, query, ptr(int32(q.Limit)))
+	wg.Wait()
 	if err != nil {
 		return result, err
 	}
+	if facetsErr != nil {
+		return result, fmt.Errorf("error counting facets: %w", facetsErr)
+	}
+	result.Facets = facets
 
 	result.Total = int(queryResult.Statistics.RecordsMatched)
 
 	result.Results = make([]logs.Result, 0, len(queryResult.Results))
 	for _, fields := range queryResult.Results {
 		var event = logs.Result{
-			Labels: t.config.Labels,
+			Labels: make(map[string]string, len(t.config.Labels)+len(fields)),
+		}
+		for k, v := range t.config.Labels {
+			event.Labels[k] = v
 		}
 
 		for _, field := range fields {
@@ -73,7 +126,7 @@ func (t *cloudWatchSearch) Search(q *logs.SearchParams) (logs.SearchResults, err
 			case "":
 				// Do nothing
 			default:
-				event.Labels[deref(field.Field)] = deref(field.Value)
+				event.Labels[t.labels.Canonical(deref(field.Field))] = deref(field.Value)
 			}
 		}
 
@@ -83,13 +136,147 @@ func (t *cloudWatchSearch) Search(q *logs.SearchParams) (logs.SearchResults, err
 	return result, nil
 }
 
-func (t *cloudWatchSearch) getQueryResults(queryID *string) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+// limitCommand matches the limit commands of an Insights query
+var limitCommand = regexp.MustCompile(`(?i)\|\s*limit\s+\d+\s*`)
+
+// withoutLimit drops the limit commands of the query so the stats commands appended to it
+// count every event.
+func withoutLimit(query string) string {
+	return strings.TrimSpace(limitCommand.ReplaceAllString(query+" ", ""))
+}
+
+// facets counts the values of the field of every facet of the search
+// with a stats query per facet.
+func (t *cloudWatchSearch) facets(ctx context.Context, q *logs.SearchParams, query string) (logs.Facets, error) {
+	query = withoutLimit(query)
+	if query != "" {
+		query += " | "
+	}
+
+	values := make([][]logs.FacetValue, len(q.Facets))
+	errs := make([]error, len(q.Facets))
+	var wg sync.WaitGroup
+	for i, label := range q.Facets {
+		wg.Add(1)
+		go func(i int, field string) {
+			defer wg.Done()
+			stats := fmt.Sprintf("%sstats count(*) as count by `%s` | sort count desc | limit %d", query, field, q.GetFacetLimit())
+			queryResult, err := t.runQuery(ctx, q, stats, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			for _, fields := range queryResult.Results {
+				var value logs.FacetValue
+				for _, f := range fields {
+					switch deref(f.Field) {
+					case "count":
+						value.Count, _ = strconv.ParseInt(deref(f.Value), 10, 64)
+					case field:
+						value.Value = deref(f.Value)
+					}
+				}
+				values[i] = append(values[i], value)
+			}
+		}(i, t.labels.Native(label))
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	facets := make(logs.Facets, len(q.Facets))
+	for i, label := range q.Facets {
+		facets[label] = values[i]
+	}
+	return facets, nil
+}
+
+// Histogram counts the events of the search with the stats command of Insights,
+// broken down by the field of the GroupBy label when set.
+func (t *cloudWatchSearch) Histogram(ctx context.Context, q *logs.HistogramParams, interval time.Duration) ([]logs.HistogramSeries, error) {
+	query, err := t.RenderQuery(&q.SearchParams)
+	if err != nil {
+		return nil, err
+	}
+	query = withoutLimit(query)
+
+	bin := fmt.Sprintf("bin(%dms)", interval.Milliseconds())
+	stats := "stats count(*) as count by " + bin
+	var groupField string
+	if q.GroupBy != "" {
+		groupField = t.labels.Native(q.GroupBy)
+		stats += ", `" + groupField + "`"
+	}
+	if query == "" {
+		query = stats
+	} else {
+		query += " | " + stats
+	}
+
+	queryResult, err := t.runQuery(ctx, &q.SearchParams, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := logs.NewHistogramCounter(interval)
+	for _, fields := range queryResult.Results {
+		var bucket time.Time
+		var group string
+		var count int64
+		for _, field := range fields {
+			switch deref(field.Field) {
+			case bin:
+				bucket, _ = time.Parse(timestampLayout, deref(field.Value))
+			case "count":
+				count, _ = strconv.ParseInt(deref(field.Value), 10, 64)
+			case groupField:
+				group = deref(field.Value)
+			}
+		}
+		if !bucket.IsZero() {
+			counter.Add(group, bucket, count)
+		}
+	}
+
+	return counter.Series(), nil
+}
+
+// runQuery runs the Insights query over the time range of the search and waits for its results.
+func (t *cloudWatchSearch) runQuery(ctx context.Context, q *logs.SearchParams, query string, limit *int32) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	logFilter := &cloudwatchlogs.StartQueryInput{
+		LogGroupName: &t.config.LogGroup,
+		Limit:        limit,
+		QueryString:  &query,
+	}
+
+	if q.GetStart() != nil {
+		logFilter.StartTime = ptr(q.GetStart().UnixMilli())
+	}
+
+	if q.GetEnd() != nil {
+		logFilter.EndTime = ptr(q.GetEnd().UnixMilli())
+	} else {
+		logFilter.EndTime = ptr(time.Now().UnixMilli()) // end time is a required field
+	}
+
+	queryOutput, err := t.client.StartQuery(ctx, logFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.getQueryResults(ctx, queryOutput.QueryId)
+}
+
+func (t *cloudWatchSearch) getQueryResults(ctx context.Context, queryID *string) (*cloudwatchlogs.GetQueryResultsOutput, error) {
 	input := &cloudwatchlogs.GetQueryResultsInput{
 		QueryId: queryID,
 	}
 
 	for {
-		resp, err := t.client.GetQueryResults(context.Background(), input)
+		resp, err := t.client.GetQueryResults(ctx, input)
 		if err != nil {
 			return nil, err
 		}
@@ -106,11 +293,27 @@ func (t *cloudWatchSearch) getQueryResults(queryID *string) (*cloudwatchlogs.Get
 		default:
 			// Might be scheduling or running.
 			// Wait before retrying.
-			time.Sleep(time.Second)
+			select {
+			case <-ctx.Done():
+				t.stopQuery(queryID)
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+			}
 		}
 	}
 }
 
+// stopQuery stops a running query so it doesn't keep
+// consuming the account's concurrent query quota after the caller has given up.
+func (t *cloudWatchSearch) stopQuery(queryID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := t.client.StopQuery(ctx, &cloudwatchlogs.StopQueryInput{QueryId: queryID}); err != nil {
+		logger.Debugf("error stopping cloudwatch query %s: %v", deref(queryID), err)
+	}
+}
+
 // timestamp layout returned by Cloudwatch
 const timestampLayout = "2006-01-02 15:04:05.000"
 
@@ -125,6 +328,86 @@ func toRFC339(input string) string {
 	return t.Format(time.RFC3339)
 }
 
+// labelFilter is the value of a label of the search: a comma separated list of values,
+// any of which matches, where * matches every value and values prefixed with ! are excluded.
+type labelFilter struct {
+	values   []string
+	excluded []string
+	any      bool
+}
+
+func newLabelFilter(value string) labelFilter {
+	var f labelFilter
+	for _, v := range strings.Split(value, ",") {
+		switch {
+		case strings.HasPrefix(v, "!"):
+			f.excluded = append(f.excluded, strings.TrimPrefix(v, "!"))
+		case v == "*":
+			f.any = true
+		default:
+			f.values = append(f.values, v)
+		}
+	}
+	return f
+}
+
+func (f labelFilter) match(value string) bool {
+	for _, v := range f.excluded {
+		if v == value {
+			return false
+		}
+	}
+	if f.any || len(f.values) == 0 {
+		return true
+	}
+	for _, v := range f.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the condition of the filter on the field.
+func (f labelFilter) render(field string) string {
+	field = "`" + field + "`"
+	var conditions []string
+	switch {
+	case f.any:
+		conditions = append(conditions, "ispresent("+field+")")
+	case len(f.values) == 1:
+		conditions = append(conditions, field+" = "+strconv.Quote(f.values[0]))
+	case len(f.values) > 1:
+		conditions = append(conditions, field+" in "+quoteList(f.values))
+	}
+
+	switch {
+	case len(f.excluded) == 1:
+		conditions = append(conditions, field+" != "+strconv.Quote(f.excluded[0]))
+	case len(f.excluded) > 1:
+		conditions = append(conditions, field+" not in "+quoteList(f.excluded))
+	}
+
+	return strings.Join(conditions, " and ")
+}
+
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func ptr[T any](val T) *T {
 	return &val
 }
@@ -0,0 +1,58 @@
+package cloudwatch
+
+import (
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestRenderQuery(t *testing.T) {
+	search := &cloudWatchSearch{
+		config: &logs.CloudWatchBackendConfig{
+			CommonBackend: logs.CommonBackend{Labels: map[string]string{"cluster": "main"}},
+			Query:         "sort @timestamp desc",
+		},
+		labels: logs.LabelMapping{logs.LabelPod: "kubernetes.pod_name"},
+	}
+
+	tests := []struct {
+		name string
+		q    logs.SearchParams
+		want string
+	}{
+		{name: "none", want: "sort @timestamp desc"},
+		{
+			name: "mapped and unmapped labels",
+			q:    logs.SearchParams{Labels: map[string]string{logs.LabelPod: "api-1", "app": "api"}},
+			want: "filter `app` = \"api\" and `kubernetes.pod_name` = \"api-1\" | sort @timestamp desc",
+		},
+		{
+			name: "values",
+			q:    logs.SearchParams{Labels: map[string]string{"app": "api,web", "level": "*", "namespace": "!kube-system,!monitoring", "env": "prod,!staging"}},
+			want: "filter `app` in [\"api\", \"web\"] and `env` = \"prod\" and `env` != \"staging\" and ispresent(`level`) and " +
+				"`namespace` not in [\"kube-system\", \"monitoring\"] | sort @timestamp desc",
+		},
+		{
+			name: "backend label",
+			q:    logs.SearchParams{Labels: map[string]string{"cluster": "main,staging", "app": "api"}},
+			want: "filter `app` = \"api\" | sort @timestamp desc",
+		},
+		{
+			name: "other backend label",
+			q:    logs.SearchParams{Labels: map[string]string{"cluster": "!main"}},
+			want: "filter 1 = 0 | sort @timestamp desc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := search.RenderQuery(&tt.q)
+			if err != nil {
+				t.Fatalf("RenderQuery() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
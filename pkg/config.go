@@ -44,6 +44,7 @@ func ParseConfig(configFile string) (*logs.SearchConfig, error) {
 // SetupBackends instantiates backends from the given configurations.
 func SetupBackends(kommonsClient *kommons.Client, backendConfigs []logs.SearchBackendConfig) []logs.SearchBackend {
 	var allBackends []logs.SearchBackend
+	names := make(map[string]bool)
 	for _, config := range backendConfigs {
 		backends, err := getBackendsFromConfigs(kommonsClient, config)
 		if err != nil {
@@ -51,8 +52,32 @@ func SetupBackends(kommonsClient *kommons.Client, backendConfigs []logs.SearchBa
 			continue
 		}
 
-		allBackends = append(allBackends, backends...)
+		for _, backend := range backends {
+			// Names identify the backends in searches & page tokens so they must be unique.
+			name := backend.Name
+			for n := 1; names[name]; n++ {
+				name = fmt.Sprintf("%s-%d", backend.Name, n)
+			}
+			if name != backend.Name {
+				logger.Warnf("duplicate backend name %s. renaming it to %s", backend.Name, name)
+				backend.Name = name
+			}
+
+			names[name] = true
+			allBackends = append(allBackends, backend)
+		}
+	}
+
+	for _, backend := range allBackends {
+		for _, route := range backend.Routes {
+			for _, fallback := range route.Fallbacks {
+				if !names[fallback] {
+					logger.Warnf("backend[%s] has an unknown fallback backend[%s]", backend.Name, fallback)
+				}
+			}
+		}
 	}
+
 	return allBackends
 }
 
@@ -78,6 +103,15 @@ var errRoutesNotProvided = fmt.Errorf("no routes provided")
 // A single configuration can have multiple backends.
 func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.SearchBackendConfig) ([]logs.SearchBackend, error) {
 	var backends []logs.SearchBackend
+	addBackend := func(backendType string, api logs.SearchAPI, config logs.CommonBackend) error {
+		backend, err := logs.NewSearchBackend(backendConfig.BackendName(backendType), backendType, api, config)
+		if err != nil {
+			return err
+		}
+
+		backends = append(backends, backend)
+		return nil
+	}
 
 	if backendConfig.Kubernetes != nil {
 		if len(backendConfig.Kubernetes.Routes) == 0 {
@@ -89,8 +123,14 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, err
 		}
 
-		backend := logs.NewSearchBackend(k8s.NewKubernetesSearchBackend(k8sclient, backendConfig.Kubernetes))
-		backends = append(backends, backend)
+		k8sSearch, err := k8s.NewKubernetesSearchBackend(k8sclient, backendConfig.Kubernetes)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the kubernetes search backend: %w", err)
+		}
+
+		if err := addBackend(logs.BackendTypeKubernetes, k8sSearch, backendConfig.Kubernetes.CommonBackend); err != nil {
+			return nil, err
+		}
 	}
 
 	if backendConfig.File != nil {
@@ -98,17 +138,34 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, errRoutesNotProvided
 		}
 
-		// If the paths are not absolute,
-		// They should be parsed with respect to the current path
-		for j, p := range backendConfig.File.Paths {
-			if !filepath.IsAbs(p) {
-				currentPath, _ := os.Getwd()
-				backendConfig.File.Paths[j] = filepath.Join(currentPath, p)
+		var fileSearch *files.FileSearch
+		var err error
+		if backendConfig.File.SSH != nil {
+			// The paths of remote files are relative to the home directory of the user
+			var credentials files.SSHCredentials
+			if credentials, err = getSSHCredentials(kommonsClient, backendConfig.File.SSH); err != nil {
+				return nil, fmt.Errorf("error getting the ssh credentials: %w", err)
+			}
+			fileSearch, err = files.NewRemoteFileSearchBackend(backendConfig.File, credentials)
+		} else {
+			// If the paths are not absolute,
+			// They should be parsed with respect to the current path
+			for j, p := range backendConfig.File.Paths {
+				if !filepath.IsAbs(p) {
+					currentPath, _ := os.Getwd()
+					backendConfig.File.Paths[j] = filepath.Join(currentPath, p)
+				}
 			}
+
+			fileSearch, err = files.NewFileSearchBackend(backendConfig.File)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error creating the file search backend: %w", err)
 		}
 
-		backend := logs.NewSearchBackend(files.NewFileSearchBackend(backendConfig.File))
-		backends = append(backends, backend)
+		if err := addBackend(logs.BackendTypeFile, fileSearch, backendConfig.File.CommonBackend); err != nil {
+			return nil, err
+		}
 	}
 
 	if backendConfig.ElasticSearch != nil {
@@ -140,8 +197,9 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, fmt.Errorf("error creating the elastic search backend: %w", err)
 		}
 
-		backend := logs.NewSearchBackend(es)
-		backends = append(backends, backend)
+		if err := addBackend(logs.BackendTypeElasticSearch, es, backendConfig.ElasticSearch.CommonBackend); err != nil {
+			return nil, err
+		}
 	}
 
 	if backendConfig.OpenSearch != nil {
@@ -173,8 +231,9 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, fmt.Errorf("error creating the openSearch backend: %w", err)
 		}
 
-		backend := logs.NewSearchBackend(osBackend)
-		backends = append(backends, backend)
+		if err := addBackend(logs.BackendTypeOpenSearch, osBackend, backendConfig.OpenSearch.CommonBackend); err != nil {
+			return nil, err
+		}
 	}
 
 	if backendConfig.CloudWatch != nil {
@@ -218,8 +277,9 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 
 		cloudwatch := cloudwatch.NewCloudWatchSearchBackend(backendConfig.CloudWatch, client)
 
-		backend := logs.NewSearchBackend(cloudwatch)
-		backends = append(backends, backend)
+		if err := addBackend(logs.BackendTypeCloudWatch, cloudwatch, backendConfig.CloudWatch.CommonBackend); err != nil {
+			return nil, err
+		}
 	}
 
 	return backends, nil
@@ -245,6 +305,29 @@ func getOpenSearchEnvVars(client *kommons.Client, conf *logs.OpenSearchBackendCo
 	return
 }
 
+func getSSHCredentials(client *kommons.Client, conf *logs.SSHConnection) (credentials files.SSHCredentials, err error) {
+	for _, v := range []struct {
+		name  string
+		env   *kommons.EnvVar
+		value *string
+	}{
+		{"username", conf.Username, &credentials.Username},
+		{"password", conf.Password, &credentials.Password},
+		{"private key", conf.PrivateKey, &credentials.PrivateKey},
+		{"passphrase", conf.Passphrase, &credentials.Passphrase},
+	} {
+		if v.env == nil {
+			continue
+		}
+		if _, *v.value, err = client.GetEnvValue(*v.env, conf.Namespace); err != nil {
+			err = fmt.Errorf("error getting the %s: %w", v.name, err)
+			return
+		}
+	}
+
+	return
+}
+
 func getElasticSearchEnvVars(kClient *kommons.Client, conf *logs.ElasticSearchBackendConfig) (cloudID, apiKey, username, password string, err error) {
 	if conf.CloudID != nil {
 		_, cloudID, err = kClient.GetEnvValue(*conf.CloudID, conf.Namespace)
@@ -0,0 +1,58 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	pkgElasticsearch "github.com/flanksource/apm-hub/external/elasticsearch"
+)
+
+// maxLabelValues is the number of values of a label, the most frequent ones, that are discovered.
+const maxLabelValues = 100
+
+// LabelKeys returns the fields of the mapping of the index and the labels of the backend.
+func (t *ElasticSearchBackend) LabelKeys(ctx context.Context) ([]string, error) {
+	res, err := t.client.Indices.GetMapping(
+		t.client.Indices.GetMapping.WithContext(ctx),
+		t.client.Indices.GetMapping.WithIndex(t.index),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the mapping: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error getting the mapping: %s", res.String())
+	}
+
+	var mapping pkgElasticsearch.MappingResponse
+	if err := json.NewDecoder(res.Body).Decode(&mapping); err != nil {
+		return nil, fmt.Errorf("error parsing the response body: %w", err)
+	}
+
+	return append(t.template.LabelKeys(mapping), t.config.LabelKeys()...), nil
+}
+
+// LabelValues returns the most frequent values of the field of the label
+// in the results of the query template over the default time range of a search.
+func (t *ElasticSearchBackend) LabelValues(ctx context.Context, label string) ([]string, error) {
+	if value, ok := t.config.Labels[label]; ok {
+		return []string{value}, nil
+	}
+
+	q := &logs.SearchParams{Facets: []string{label}, FacetLimit: maxLabelValues}
+	q.SetDefaults()
+
+	results, err := t.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(results.Facets[label]))
+	for _, v := range results.Facets[label] {
+		values = append(values, v.Value)
+	}
+	return values, nil
+}
@@ -1,11 +1,11 @@
 package elasticsearch
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"text/template"
+	"strings"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/flanksource/apm-hub/api/logs"
@@ -14,8 +14,7 @@ import (
 
 type ElasticSearchBackend struct {
 	client   *elasticsearch.Client
-	fields   logs.ElasticSearchFields
-	template *template.Template
+	template *pkgElasticsearch.Template
 	index    string
 	config   *logs.ElasticSearchBackendConfig
 }
@@ -29,51 +28,81 @@ func NewElasticSearchBackend(client *elasticsearch.Client, config *logs.ElasticS
 		return nil, fmt.Errorf("index is empty")
 	}
 
-	template, err := template.New("query").Parse(config.Query)
+	template, err := pkgElasticsearch.NewTemplate(config.Query, config.Fields, config.GetLabelMapping(logs.BackendTypeElasticSearch), config.Labels)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing template: %w", err)
+		return nil, err
 	}
 
 	return &ElasticSearchBackend{
 		client:   client,
-		index:    config.Index,
-		fields:   config.Fields,
 		template: template,
+		index:    config.Index,
 		config:   config,
 	}, nil
 }
 
-func (t *ElasticSearchBackend) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
-	return t.config.CommonBackend.Routes.MatchRoute(q)
+// RenderQuery renders the query template with the search params, see the Template of external/elasticsearch.
+func (t *ElasticSearchBackend) RenderQuery(q *logs.SearchParams) (string, error) {
+	return t.template.RenderQuery(q)
 }
 
-func (t *ElasticSearchBackend) Search(q *logs.SearchParams) (logs.SearchResults, error) {
-	var result logs.SearchResults
-	var buf bytes.Buffer
+// Capabilities of Elasticsearch, see the Template of external/elasticsearch.
+func (t *ElasticSearchBackend) Capabilities() logs.Capabilities {
+	return t.template.Capabilities()
+}
 
-	if err := t.template.Execute(&buf, q); err != nil {
-		return result, fmt.Errorf("error executing template: %w", err)
+func (t *ElasticSearchBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	query, err := t.RenderQuery(q)
+	if err != nil {
+		return logs.SearchResults{}, err
 	}
 
 	res, err := t.client.Search(
-		t.client.Search.WithContext(context.Background()),
+		t.client.Search.WithContext(ctx),
 		t.client.Search.WithIndex(t.index),
-		t.client.Search.WithBody(&buf),
+		t.client.Search.WithBody(strings.NewReader(query)),
 		t.client.Search.WithSize(int(q.Limit+1)),
 		t.client.Search.WithErrorTrace(),
 	)
 	if err != nil {
-		return result, fmt.Errorf("error searching: %w", err)
+		return logs.SearchResults{}, fmt.Errorf("error searching: %w", err)
 	}
 	defer res.Body.Close()
 
 	var r pkgElasticsearch.SearchResponse
 	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		return result, fmt.Errorf("error parsing the response body: %w", err)
+		return logs.SearchResults{}, fmt.Errorf("error parsing the response body: %w", err)
+	}
+
+	return t.template.SearchResults(q, r)
+}
+
+// Histogram counts the hits of the search with a date histogram aggregation,
+// nested in a terms aggregation on the field of the GroupBy label when set.
+func (t *ElasticSearchBackend) Histogram(ctx context.Context, q *logs.HistogramParams, interval time.Duration) ([]logs.HistogramSeries, error) {
+	body, grouped, err := t.template.RenderHistogram(q, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.client.Search(
+		t.client.Search.WithContext(ctx),
+		t.client.Search.WithIndex(t.index),
+		t.client.Search.WithBody(strings.NewReader(body)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error searching: %s", res.String())
+	}
+
+	var r pkgElasticsearch.HistogramResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("error parsing the response body: %w", err)
 	}
 
-	result.Results = r.Hits.GetResultsFromHits(q.Limit, t.fields.Message, t.fields.Timestamp, t.config.Labels, t.fields.Exclusions...)
-	result.Total = int(r.Hits.Total.Value)
-	result.NextPage = r.Hits.NextPage(int(q.Limit))
-	return result, nil
+	return r.Series(grouped), nil
 }
@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"net/http"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/labstack/echo/v4"
+)
+
+// Explain describes how a search would be routed to the backends
+// without running it.
+func Explain(c echo.Context) error {
+	cc := c.(*api.Context)
+	searchParams := new(logs.SearchParams)
+	if err := c.Bind(searchParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	searchParams.SetDefaults()
+
+	explanation, err := ExplainSearch(logs.GlobalBackends, searchParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return cc.JSON(http.StatusOK, explanation)
+}
+
+// ExplainSearch explains the routing decision made for every backend
+// and renders the query of the templated backends the search would run on.
+func ExplainSearch(backends []logs.SearchBackend, q *logs.SearchParams) (*logs.SearchExplanation, error) {
+	if _, err := query.Parse(q.Query); err != nil {
+		return nil, err
+	}
+
+	page, err := decodePage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, explanations := planSearch(backends, q, page)
+
+	// The results of the first backend with an additive route
+	// replace the results of every other backend.
+	var additive string
+	for _, m := range matched {
+		if m.route.IsAdditive {
+			additive = m.backend.Name
+			break
+		}
+	}
+
+	explanation := &logs.SearchExplanation{Run: []string{}}
+	for _, m := range matched {
+		explanation.Run = append(explanation.Run, m.backend.Name)
+	}
+
+	for i := range explanations {
+		if !explanations[i].Run {
+			continue
+		}
+
+		if additive != "" && explanations[i].Backend != additive {
+			explanations[i].Discarded = true
+		}
+
+		backend, route := backends[i], explanations[i].Route
+		backendParams := q.Clone()
+		if page != nil {
+			backendParams.Page = page.Cursors[backend.Name]
+		}
+
+		// The searches are mapped like they are when they run, see searchRoute
+		queries, err := rewriteSearch(route, backendParams)
+		if err != nil {
+			explanations[i].QueryError = err.Error()
+			continue
+		}
+		if len(queries) > 1 {
+			paged, err := pageFannedOut(backendParams.Page, queries)
+			if err != nil {
+				explanations[i].QueryError = err.Error()
+				continue
+			}
+			fannedOut := make([]logs.SearchParams, 0, len(paged))
+			for _, j := range paged {
+				fannedOut = append(fannedOut, queries[j])
+			}
+			queries = fannedOut
+		}
+		if route.Rewrite != nil {
+			explanations[i].Rewrites = queries
+		}
+
+		renderer, ok := backend.API.(logs.QueryRenderer)
+		if !ok {
+			continue
+		}
+
+		for j := range queries {
+			sent, _, err := prepareSearch(&queries[j], backend.API.Capabilities())
+			if err != nil {
+				explanations[i].QueryError = err.Error()
+				break
+			}
+
+			rendered, err := renderer.RenderQuery(sent)
+			if err != nil {
+				explanations[i].QueryError = err.Error()
+				break
+			}
+			explanations[i].Queries = append(explanations[i].Queries, rendered)
+		}
+	}
+
+	explanation.Backends = explanations
+	return explanation, nil
+}
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// renderedSearch is a templated backend that renders the labels, limit and page of its searches.
+type renderedSearch struct {
+	staticSearch
+	rendered *[]string
+}
+
+func (t renderedSearch) Capabilities() logs.Capabilities {
+	return logs.Capabilities{Labels: true, Limit: true}
+}
+
+func (t renderedSearch) RenderQuery(q *logs.SearchParams) (string, error) {
+	return fmt.Sprintf("labels=%v limit=%d page=%q", q.Labels, q.Limit, q.Page), nil
+}
+
+func (t renderedSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	query, err := t.RenderQuery(q)
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+	*t.rendered = append(*t.rendered, query)
+	return t.staticSearch.Search(ctx, q)
+}
+
+func TestExplainSearchQueries(t *testing.T) {
+	var rendered []string
+	route := logs.SearchRoute{Type: "Nginx", Labels: map[string]string{"type": "access"}}
+	backends := []logs.SearchBackend{{Name: "nginx", Routes: logs.Routes{route}, API: renderedSearch{rendered: &rendered}}}
+
+	page := logs.NewPageToken()
+	page.Cursors["nginx"] = "20"
+	token, err := page.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{
+		Type:   "Nginx",
+		Labels: map[string]string{logs.LabelBackend: "nginx", "type": "access", "host": "acmehost"},
+		Limit:  10,
+		Page:   token,
+	}
+
+	explanation, err := ExplainSearch(backends, q)
+	if err != nil {
+		t.Fatalf("ExplainSearch() error = %v", err)
+	}
+	if _, err := SearchBackends(context.Background(), backends, q); err != nil {
+		t.Fatalf("SearchBackends() error = %v", err)
+	}
+
+	// The explained query is the query the search sends to the backend
+	want := []string{`labels=map[host:acmehost] limit=30 page=""`}
+	if got := explanation.Backends[0].Queries; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExplainSearch() queries = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(rendered, want) {
+		t.Errorf("SearchBackends() queries = %v, want %v", rendered, want)
+	}
+}
@@ -0,0 +1,243 @@
+package files
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/logger"
+)
+
+// DefaultIndexInterval is the default number of lines between two entries of the index of a file.
+const DefaultIndexInterval = 1000
+
+// indexSuffix is the suffix of the names of the index files, which are never searched.
+const indexSuffix = ".apm-hub-index"
+
+// indexVersion is the version of the format of the index files. Indexes of other versions are rebuilt.
+const indexVersion = 1
+
+// indexHeadSize is the size of the start of a file whose hash identifies the file, so a file that was rotated,
+// and replaced by a new one, isn't searched with the index of the old one. Smaller files are identified
+// by the hash of their content when they were indexed.
+const indexHeadSize = 1024
+
+// indexEntry is the timestamp of a line and the offset it starts at.
+type indexEntry struct {
+	Time   int64 `json:"t"`
+	Offset int64 `json:"o"`
+}
+
+// fileIndex is a sparse index of the timestamps of the lines of a file: an entry every interval lines.
+type fileIndex struct {
+	Version int    `json:"version"`
+	Layout  string `json:"layout"`
+	// Head is the hash of the first HeadSize bytes of the file
+	Head     string `json:"head"`
+	HeadSize int64  `json:"head_size"`
+	// Size is the offset the file is indexed up to, the end of its last complete line
+	Size int64 `json:"size"`
+	// Lines is the number of lines indexed since the last entry
+	Lines   int          `json:"lines"`
+	Entries []indexEntry `json:"entries"`
+}
+
+// bounds returns the part of the file, up to its size, that the lines at the time start in.
+// The lines before the part are before the time.
+func (t *fileIndex) bounds(size int64, at time.Time) (int64, int64) {
+	if t == nil {
+		return 0, size
+	}
+
+	i := sort.Search(len(t.Entries), func(i int) bool { return t.Entries[i].Time >= at.UnixNano() })
+
+	low, high := int64(0), size
+	if i > 0 {
+		low = t.Entries[i-1].Offset
+	}
+	if i < len(t.Entries) && t.Entries[i].Offset < high {
+		high = t.Entries[i].Offset
+	}
+
+	return low, high
+}
+
+// fileIndexer maintains the sparse time indexes of the files of a backend, on disk and in memory.
+type fileIndexer struct {
+	// dir is the directory the indexes are stored in, or the directory of every file when empty
+	dir      string
+	interval int
+
+	mu      sync.Mutex
+	indexes map[string]*fileIndex
+}
+
+func newFileIndexer(config *logs.FileIndex) *fileIndexer {
+	if config == nil {
+		return nil
+	}
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultIndexInterval
+	}
+
+	return &fileIndexer{dir: config.Dir, interval: interval, indexes: make(map[string]*fileIndex)}
+}
+
+// indexPath returns the path of the index of the file.
+func (t *fileIndexer) indexPath(path string) string {
+	if t.dir == "" {
+		dir, name := filepath.Split(path)
+		return filepath.Join(dir, "."+name+indexSuffix)
+	}
+
+	// Files with the same name in different directories share the index directory
+	hash := sha256.Sum256([]byte(path))
+	return filepath.Join(t.dir, hex.EncodeToString(hash[:8])+"-"+filepath.Base(path)+indexSuffix)
+}
+
+// index returns the index of the uncompressed file, updated with the lines appended to the file
+// since it was last indexed. The index is rebuilt when the file was truncated, or rotated
+// as the start of the file then changes.
+// It returns nil when the file can't be indexed.
+func (t *fileIndexer) index(file io.ReaderAt, path string, size int64, timestamp *lineTimestamp) *fileIndex {
+	if t == nil || timestamp == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	index, ok := t.indexes[path]
+	if !ok {
+		index = t.load(path)
+	}
+	if index != nil && index.Version == indexVersion && index.Layout == timestamp.layout && index.Size <= size {
+		if head, err := fileHead(file, index.HeadSize); err != nil || head != index.Head {
+			index = nil
+		}
+	} else {
+		index = nil
+	}
+	if index == nil {
+		index = &fileIndex{Version: indexVersion, Layout: timestamp.layout}
+	}
+
+	if index.Size < size {
+		if err := t.update(index, file, size, timestamp); err != nil {
+			logger.Warnf("error indexing file. path=%s; %v", path, err)
+			return nil
+		}
+		if index.HeadSize < indexHeadSize {
+			index.HeadSize = index.Size
+			if index.HeadSize > indexHeadSize {
+				index.HeadSize = indexHeadSize
+			}
+			head, err := fileHead(file, index.HeadSize)
+			if err != nil {
+				logger.Warnf("error indexing file. path=%s; %v", path, err)
+				return nil
+			}
+			index.Head = head
+		}
+		t.save(path, index)
+	}
+
+	t.indexes[path] = index
+	return index
+}
+
+// update indexes the complete lines of the file after the size of the index.
+func (t *fileIndexer) update(index *fileIndex, file io.ReaderAt, size int64, timestamp *lineTimestamp) error {
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, index.Size, size-index.Size), seekBlockSize)
+	offset := index.Size
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// A line without a newline is still being written and is indexed once it's complete
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(index.Entries) == 0 || index.Lines >= t.interval {
+			if ts, ok := timestamp.find(line); ok {
+				index.Entries = append(index.Entries, indexEntry{Time: ts.UnixNano(), Offset: offset})
+				index.Lines = 0
+			}
+		}
+		index.Lines++
+		offset += int64(len(line))
+		index.Size = offset
+	}
+}
+
+// load reads the index of the file from disk, or returns nil when there's none.
+func (t *fileIndexer) load(path string) *fileIndex {
+	data, err := os.ReadFile(t.indexPath(path))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warnf("error reading the index of file. path=%s; %v", path, err)
+		}
+		return nil
+	}
+
+	var index fileIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		logger.Warnf("error reading the index of file. path=%s; %v", path, err)
+		return nil
+	}
+
+	return &index
+}
+
+// save writes the index of the file to disk. Indexes that can't be written, e.g. next to files
+// on a read-only mount, are kept in memory.
+func (t *fileIndexer) save(path string, index *fileIndex) {
+	data, err := json.Marshal(index)
+	if err != nil {
+		logger.Warnf("error writing the index of file. path=%s; %v", path, err)
+		return
+	}
+
+	indexPath := t.indexPath(path)
+	if t.dir != "" {
+		if err := os.MkdirAll(t.dir, 0o755); err != nil {
+			logger.Warnf("error writing the index of file. path=%s; %v", path, err)
+			return
+		}
+	}
+
+	// The index is written to a temporary file first so readers never see a partial index
+	tmp := indexPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		logger.Debugf("error writing the index of file. path=%s; %v", path, err)
+		return
+	}
+	if err := os.Rename(tmp, indexPath); err != nil {
+		logger.Warnf("error writing the index of file. path=%s; %v", path, err)
+		os.Remove(tmp)
+	}
+}
+
+// fileHead returns the hash of the first bytes of the file.
+func fileHead(file io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, size)
+	if _, err := file.ReadAt(head, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	hash := sha256.Sum256(head)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,142 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestFileIndexer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	base := time.Date(2023, 3, 9, 10, 0, 0, 0, time.UTC)
+	lines := func(from, to int) string {
+		var b strings.Builder
+		for i := from; i < to; i++ {
+			fmt.Fprintf(&b, "%s line %d\n", base.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+		}
+		return b.String()
+	}
+
+	timestamp, err := newLineTimestamp(time.RFC3339)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := newFileIndexer(&logs.FileIndex{Interval: 10})
+	index := func() *fileIndex {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		fInfo, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return indexer.index(file, path, fInfo.Size(), timestamp)
+	}
+
+	// The partial line at the end of the file is indexed once it's complete
+	content := lines(0, 25)
+	if err := os.WriteFile(path, []byte(content+"partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := index()
+	if len(got.Entries) != 3 || got.Size != int64(len(content)) {
+		t.Fatalf("index() = %d entries up to %d, want 3 entries up to %d", len(got.Entries), got.Size, len(content))
+	}
+	for i, entry := range got.Entries {
+		if want := base.Add(time.Duration(i*10) * time.Second).UnixNano(); entry.Time != want {
+			t.Errorf("index() entry %d time = %d, want %d", i, entry.Time, want)
+		}
+		if want := int64(len(lines(0, i*10))); entry.Offset != want {
+			t.Errorf("index() entry %d offset = %d, want %d", i, entry.Offset, want)
+		}
+	}
+
+	low, high := got.bounds(got.Size, base.Add(15*time.Second))
+	if wantLow, wantHigh := int64(len(lines(0, 10))), int64(len(lines(0, 20))); low != wantLow || high != wantHigh {
+		t.Errorf("bounds() = (%d, %d), want (%d, %d)", low, high, wantLow, wantHigh)
+	}
+
+	// The index is saved, and updated with the lines appended to the file
+	content = lines(0, 45)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexer = newFileIndexer(&logs.FileIndex{Interval: 10})
+	if loaded := indexer.load(path); loaded == nil || len(loaded.Entries) != 3 {
+		t.Fatalf("load() = %+v, want the saved index", loaded)
+	}
+	if got = index(); len(got.Entries) != 5 || got.Size != int64(len(content)) {
+		t.Errorf("index() = %d entries up to %d, want 5 entries up to %d", len(got.Entries), got.Size, len(content))
+	}
+
+	// A file replaced by a new one, rotated or truncated, is indexed again
+	content = lines(100, 112)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got = index()
+	if len(got.Entries) != 2 || got.Entries[0].Time != base.Add(100*time.Second).UnixNano() || got.Size != int64(len(content)) {
+		t.Errorf("index() = %+v, want the index of the new file", got)
+	}
+}
+
+func TestFileSearchIndexed(t *testing.T) {
+	dir := t.TempDir()
+	indexDir := t.TempDir()
+	base := time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Second)
+
+	var b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "%s line %d\n", base.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+	}
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{
+		Paths: []string{filepath.Join(dir, "*")},
+		Index: &logs.FileIndex{Dir: indexDir, Interval: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sort := range []string{logs.SortAscending, logs.SortDescending} {
+		res, err := search.Search(context.Background(), &logs.SearchParams{
+			Sort:  sort,
+			Start: base.Add(12345 * time.Second).Format(time.RFC3339),
+			End:   base.Add(12347 * time.Second).Format(time.RFC3339),
+		})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+
+		var got []string
+		for _, r := range res.Results {
+			got = append(got, r.Message[strings.IndexByte(r.Message, ' ')+1:])
+		}
+		want := []string{"line 12345", "line 12346", "line 12347"}
+		if sort == logs.SortDescending {
+			want = []string{"line 12347", "line 12346", "line 12345"}
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Search() %s = %v, want %v", sort, got, want)
+		}
+	}
+
+	// The index is stored in the index directory
+	indexes, _ := filepath.Glob(filepath.Join(indexDir, "*"+indexSuffix))
+	if len(indexes) != 1 {
+		t.Errorf("index files = %v, want the index of the file", indexes)
+	}
+}
@@ -0,0 +1,43 @@
+package files
+
+import (
+	"context"
+	"sort"
+)
+
+// LabelKeys returns the path of the lines, the host of remote files, the labels of the backend
+// and the labels captured by its parser.
+func (t *FileSearch) LabelKeys(ctx context.Context) ([]string, error) {
+	keys := []string{"path"}
+	if t.remote != nil {
+		keys = append(keys, "host")
+	}
+	keys = append(keys, t.config.LabelKeys()...)
+	return append(keys, t.parser.labelKeys()...), nil
+}
+
+// LabelValues returns the paths of the local files matched by the globs of the backend,
+// the remote hosts, or the value of a label of the backend.
+func (t *FileSearch) LabelValues(ctx context.Context, label string) ([]string, error) {
+	if t.remote != nil {
+		switch label {
+		case "host":
+			return t.remote.hosts, nil
+		case "path":
+			// The files of remote hosts aren't listed
+			return nil, nil
+		}
+	}
+
+	if label == "path" {
+		paths := unfoldGlobs(t.config.Paths)
+		sort.Strings(paths)
+		return paths, nil
+	}
+
+	if value, ok := t.config.Labels[label]; ok {
+		return []string{value}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,141 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestFileSearchMultiline(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+
+	var b strings.Builder
+	var want []string
+	for i := 0; i < 6; i++ {
+		ts := base.Add(time.Duration(i) * time.Second).Format(time.RFC3339)
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "%s INFO request %d\n", ts, i)
+			want = append(want, ts+" INFO request "+fmt.Sprint(i))
+			continue
+		}
+		fmt.Fprintf(&b, "%s ERROR request %d\njava.lang.IllegalStateException: closed\n\tat com.acme.Api.get(Api.java:%d)\n\tat com.acme.Main.main(Main.java:3)\n", ts, i, i)
+		want = append(want,
+			fmt.Sprintf("%s ERROR request %d\njava.lang.IllegalStateException: closed\n\tat com.acme.Api.get(Api.java:%d)", ts, i, i),
+			"at com.acme.Main.main(Main.java:3)",
+		)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{
+		Paths:     []string{filepath.Join(dir, "*")},
+		Multiline: &logs.MultilineConfig{Detectors: []string{logs.MultilineJava}, MaxLines: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pages returns the messages, and the times, of every page of the search
+	pages := func(q logs.SearchParams) ([]string, []string) {
+		var messages, times []string
+		for i := 0; i < 50; i++ {
+			res, err := search.Search(context.Background(), &q)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			for _, r := range res.Results {
+				messages = append(messages, r.Message)
+				times = append(times, r.Time)
+			}
+			if res.NextPage == "" {
+				return messages, times
+			}
+			q.Page = res.NextPage
+		}
+		t.Fatalf("Search() didn't stop paging")
+		return nil, nil
+	}
+
+	got, times := pages(logs.SearchParams{Limit: 2, Sort: logs.SortAscending})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() ascending = %q, want %q", got, want)
+	}
+	// The lines after the maximum lines of an event have the timestamp of its first line
+	if wantTime := base.Add(time.Second).Format(time.RFC3339Nano); len(times) < 3 || times[1] != wantTime || times[2] != wantTime {
+		t.Errorf("Search() ascending times = %v, want the events of the stack trace at %s", times, wantTime)
+	}
+
+	var descending []string
+	for i := len(want) - 1; i >= 0; i-- {
+		descending = append(descending, want[i])
+	}
+	if got, _ := pages(logs.SearchParams{Limit: 3}); !reflect.DeepEqual(got, descending) {
+		t.Errorf("Search() descending = %q, want %q", got, descending)
+	}
+
+	got, _ = pages(logs.SearchParams{Query: "IllegalStateException", Sort: logs.SortAscending})
+	if len(got) != 3 {
+		t.Errorf("Search() of the stack traces = %q, want the 3 events", got)
+	}
+}
+
+func TestFileTailMultiline(t *testing.T) {
+	interval := TailInterval
+	TailInterval = 10 * time.Millisecond
+	defer func() { TailInterval = interval }()
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{
+		Paths:     []string{path},
+		Multiline: &logs.MultilineConfig{Detectors: []string{logs.MultilineJava}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := make(chan logs.Result)
+	go search.Tail(ctx, &logs.SearchParams{}, results)
+
+	time.Sleep(5 * TailInterval)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// The stack trace is appended across reads of the tail
+	fmt.Fprint(file, "ERROR request failed\njava.lang.IllegalStateException: closed\n")
+	time.Sleep(TailInterval / 2)
+	fmt.Fprint(file, "\tat com.acme.Api.get(Api.java:12)\nINFO next request\n")
+
+	want := []string{
+		"ERROR request failed\njava.lang.IllegalStateException: closed\n\tat com.acme.Api.get(Api.java:12)",
+		"INFO next request",
+	}
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case r := <-results:
+			got = append(got, r.Message)
+		case <-ctx.Done():
+			t.Fatalf("Tail() sent %q, want %q", got, want)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail() = %q, want %q", got, want)
+	}
+}
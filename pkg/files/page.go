@@ -0,0 +1,51 @@
+package files
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filePosition is a position in a file of a rotation family: the offset of the start of a line,
+// in the decompressed content of compressed files.
+type filePosition struct {
+	path   string
+	offset int64
+}
+
+func (t filePosition) String() string {
+	return t.path + ":" + strconv.FormatInt(t.offset, 10)
+}
+
+func parseFilePosition(position string) (filePosition, error) {
+	i := strings.LastIndexByte(position, ':')
+	if i <= 0 {
+		return filePosition{}, fmt.Errorf("invalid file position %q: must be path:offset", position)
+	}
+
+	offset, err := strconv.ParseInt(position[i+1:], 10, 64)
+	if err != nil || offset < 0 {
+		return filePosition{}, fmt.Errorf("invalid offset of file position %q", position)
+	}
+
+	return filePosition{path: position[:i], offset: offset}, nil
+}
+
+// parsePageToken parses the positions the rotation families are read from by the next page, keyed by family.
+// The token is a comma separated list of path:offset, one for every family that hasn't been read to its end.
+func parsePageToken(page string) (map[string]filePosition, error) {
+	positions := make(map[string]filePosition)
+	if page == "" {
+		return positions, nil
+	}
+
+	for _, token := range strings.Split(page, ",") {
+		position, err := parseFilePosition(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page token: %w", err)
+		}
+		positions[newRotatedFile(position.path).family] = position
+	}
+
+	return positions, nil
+}
@@ -0,0 +1,99 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestFileSearchPages(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	event := func(i int) string {
+		return fmt.Sprintf("%s event %d\n  trace %d\n", base.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i, i)
+	}
+
+	var rotated, current, other bytes.Buffer
+	gz := gzip.NewWriter(&rotated)
+	for i := 0; i < 5; i++ {
+		fmt.Fprint(gz, event(i))
+	}
+	gz.Close()
+	for i := 5; i < 10; i++ {
+		fmt.Fprint(&current, event(i))
+	}
+	for j := 0; j < 3; j++ {
+		fmt.Fprintf(&other, "%s other %d\n", base.Add(time.Duration(j)*3*time.Second+500*time.Millisecond).Format(time.RFC3339Nano), j)
+	}
+	for name, content := range map[string][]byte{"app.log.1.gz": rotated.Bytes(), "app.log": current.Bytes(), "other.log": other.Bytes()} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{Paths: []string{filepath.Join(dir, "*")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pages returns the messages of every page of the search
+	pages := func(q logs.SearchParams) []string {
+		var messages []string
+		for i := 0; i < 50; i++ {
+			res, err := search.Search(context.Background(), &q)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			for _, r := range res.Results {
+				message := r.Message
+				if strings.HasPrefix(message, base.Format("2006")) {
+					message = message[strings.IndexByte(message, ' ')+1:]
+				}
+				messages = append(messages, message)
+			}
+			if res.NextPage == "" {
+				return messages
+			}
+			q.Page = res.NextPage
+		}
+		t.Fatalf("Search() didn't stop paging")
+		return nil
+	}
+
+	// Continuation lines have the timestamp of the line before them, and lines with the same timestamp
+	// are returned in the order they're read in
+	var want, ascending []string
+	for i := 9; i >= 0; i-- {
+		if i%3 == 0 && i < 9 {
+			want = append(want, fmt.Sprintf("other %d", i/3))
+		}
+		want = append(want, fmt.Sprintf("trace %d", i), fmt.Sprintf("event %d", i))
+	}
+	for i := 0; i < 10; i++ {
+		ascending = append(ascending, fmt.Sprintf("event %d", i), fmt.Sprintf("trace %d", i))
+		if i%3 == 0 && i < 9 {
+			ascending = append(ascending, fmt.Sprintf("other %d", i/3))
+		}
+	}
+
+	if got := pages(logs.SearchParams{Limit: 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() descending pages = %v, want %v", got, want)
+	}
+	if got := pages(logs.SearchParams{Limit: 4, Sort: logs.SortAscending}); !reflect.DeepEqual(got, ascending) {
+		t.Errorf("Search() ascending pages = %v, want %v", got, ascending)
+	}
+
+	got := pages(logs.SearchParams{Limit: 2, Query: "trace", Start: base.Add(3 * time.Second).Format(time.RFC3339), End: base.Add(6 * time.Second).Format(time.RFC3339)})
+	if want := []string{"trace 6", "trace 5", "trace 4", "trace 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() pages of the window = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package files
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// Groups of a parser with a special meaning. Every other named group becomes a label.
+const (
+	groupTimestamp = "timestamp"
+	groupMessage   = "message"
+	groupLevel     = "level"
+	groupPriority  = "priority"
+)
+
+// grokPatterns are the grok patterns that can be used in the regular expressions of parsers,
+// as %{NAME} or as %{NAME:group} to capture them.
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"POSINT":            `\d+`,
+	"NUMBER":            `[+-]?\d+(?:\.\d+)?`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"IP":                `(?:\d{1,3}(?:\.\d{1,3}){3}|[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+)`,
+	"HOSTNAME":          `[0-9A-Za-z][0-9A-Za-z._-]*`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"USER":              `[\w.@-]+`,
+	"PROG":              `[\w./-]+`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|alert|emerg)`,
+	"HTTPDATE":          `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	"SYSLOGTIMESTAMP":   `\w{3} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"NGINXERRORTIME":    `\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`,
+	"KLOGTIME":          `\d{4} \d{2}:\d{2}:\d{2}\.\d+`,
+	"KLOGLEVEL":         `[IWEF]`,
+	"SYSLOGDATA":        `(?:\[(?:[^\]\\]|\\.)*\])+`,
+}
+
+// builtinParser is a built-in pattern and the layout of its timestamp.
+type builtinParser struct {
+	regex  string
+	layout string
+}
+
+var httpLogRegex = `^%{IPORHOST:client} %{USER:ident} %{USER:user} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:method} %{NOTSPACE:request}(?: HTTP/%{NUMBER:http_version})?|%{DATA:raw_request})" %{POSINT:status} (?:%{POSINT:bytes}|-)(?: "%{DATA:referrer}" "%{DATA:user_agent}")?`
+
+var builtinParsers = map[string]builtinParser{
+	// nginx combined log format
+	"nginx": {regex: httpLogRegex, layout: "02/Jan/2006:15:04:05 -0700"},
+	// apache common and combined log formats
+	"apache": {regex: httpLogRegex, layout: "02/Jan/2006:15:04:05 -0700"},
+	"nginx-error": {
+		regex:  `^%{NGINXERRORTIME:timestamp} \[%{WORD:level}\] %{POSINT:pid}#%{POSINT:tid}: (?:\*%{POSINT:connection} )?%{GREEDYDATA:message}`,
+		layout: "2006/01/02 15:04:05",
+	},
+	"syslog-rfc3164": {
+		regex:  `^(?:<%{POSINT:priority}>)?%{SYSLOGTIMESTAMP:timestamp} %{HOSTNAME:host} %{PROG:program}(?:\[%{POSINT:pid}\])?: %{GREEDYDATA:message}`,
+		layout: time.Stamp,
+	},
+	"syslog-rfc5424": {
+		regex:  `^<%{POSINT:priority}>%{POSINT:version} %{TIMESTAMP_ISO8601:timestamp} %{NOTSPACE:host} %{NOTSPACE:app} %{NOTSPACE:pid} %{NOTSPACE:msgid} (?:-|%{SYSLOGDATA:structured_data}) ?%{GREEDYDATA:message}`,
+		layout: time.RFC3339Nano,
+	},
+	"klog": {
+		regex:  `^%{KLOGLEVEL:level}%{KLOGTIME:timestamp} +%{POSINT:thread} %{NOTSPACE:source}\] %{GREEDYDATA:message}`,
+		layout: "0102 15:04:05.999999",
+	},
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// expandGrok replaces the grok patterns of the regular expression with their definition.
+func expandGrok(regex string) (string, error) {
+	// Patterns may reference other patterns, so they are expanded a few levels deep
+	for depth := 0; depth < 5 && grokReference.MatchString(regex); depth++ {
+		var err error
+		regex = grokReference.ReplaceAllStringFunc(regex, func(ref string) string {
+			match := grokReference.FindStringSubmatch(ref)
+			pattern, ok := grokPatterns[match[1]]
+			if !ok {
+				err = fmt.Errorf("unknown grok pattern %q", match[1])
+				return ref
+			}
+			if match[2] == "" {
+				return "(?:" + pattern + ")"
+			}
+			return "(?P<" + match[2] + ">" + pattern + ")"
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return regex, nil
+}
+
+// lineParser parses the lines of files into labels with a regular expression.
+type lineParser struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+// newLineParser returns the parser of the config, or nil when there's no config.
+func newLineParser(config *logs.FileParser) (*lineParser, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	regex, layout := config.Regex, config.TimestampLayout
+	switch {
+	case config.Pattern != "" && config.Regex != "":
+		return nil, fmt.Errorf("parser.pattern and parser.regex are mutually exclusive")
+	case config.Pattern != "":
+		builtin, ok := builtinParsers[config.Pattern]
+		if !ok {
+			return nil, fmt.Errorf("unknown parser.pattern %q: must be one of nginx, nginx-error, apache, syslog-rfc3164, syslog-rfc5424 or klog", config.Pattern)
+		}
+		regex = builtin.regex
+		if layout == "" {
+			layout = builtin.layout
+		}
+	case config.Regex == "":
+		return nil, fmt.Errorf("parser.pattern or parser.regex is required")
+	}
+
+	expanded, err := expandGrok(regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser.regex: %w", err)
+	}
+
+	compiled, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser.regex: %w", err)
+	}
+
+	return &lineParser{regex: compiled, layout: layout}, nil
+}
+
+// labelKeys returns the labels captured by the parser.
+func (t *lineParser) labelKeys() []string {
+	if t == nil {
+		return nil
+	}
+
+	var keys []string
+	for _, name := range t.regex.SubexpNames() {
+		switch name {
+		case "", groupTimestamp, groupMessage, groupPriority:
+			continue
+		}
+		keys = append(keys, name)
+	}
+	if t.regex.SubexpIndex(groupPriority) >= 0 && t.regex.SubexpIndex(groupLevel) < 0 {
+		keys = append(keys, logs.LabelLevel)
+	}
+
+	return keys
+}
+
+// parse sets the labels, time and message of the result from the groups captured in its message.
+// Results that don't match are returned as they are, and the labels the result already has are kept.
+func (t *lineParser) parse(r logs.Result) logs.Result {
+	if t == nil {
+		return r
+	}
+
+	match := t.regex.FindStringSubmatch(r.Message)
+	if match == nil {
+		return r
+	}
+
+	labels := make(map[string]string, len(match)+len(r.Labels))
+	for i, name := range t.regex.SubexpNames() {
+		value := match[i]
+		// Empty groups, and the dashes logs write in place of missing values, aren't labels
+		if name == "" || value == "" || value == "-" {
+			continue
+		}
+
+		switch name {
+		case groupTimestamp:
+			if ts, ok := t.parseTime(value); ok {
+				r.Time = ts.UTC().Format(time.RFC3339Nano)
+			}
+		case groupMessage:
+			r.Message = value
+		case groupLevel:
+			labels[logs.LabelLevel] = logs.NormalizeLevel(value)
+		case groupPriority:
+			if _, ok := labels[logs.LabelLevel]; !ok {
+				if level, ok := priorityLevel(value); ok {
+					labels[logs.LabelLevel] = level
+				}
+			}
+		default:
+			labels[name] = value
+		}
+	}
+
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	r.Labels = labels
+
+	return r
+}
+
+// parseTime parses the captured timestamp with the layout of the parser, or with the known layouts.
+func (t *lineParser) parseTime(value string) (time.Time, bool) {
+	if t.layout == "" {
+		return logs.ParseTimestamp(value)
+	}
+
+	return parseLayoutTime(t.layout, value)
+}
+
+// priorityLevel returns the level of a syslog priority, whose severity is its lowest three bits.
+func priorityLevel(priority string) (string, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(priority))
+	if err != nil {
+		return "", false
+	}
+
+	switch n % 8 {
+	case 0, 1, 2:
+		return logs.LevelFatal, true
+	case 3:
+		return logs.LevelError, true
+	case 4:
+		return logs.LevelWarn, true
+	case 5, 6:
+		return logs.LevelInfo, true
+	}
+
+	return logs.LevelDebug, true
+}
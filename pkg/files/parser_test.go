@@ -0,0 +1,103 @@
+package files
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestLineParserParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		config logs.FileParser
+		in     logs.Result
+		want   logs.Result
+	}{
+		{
+			name:   "nginx",
+			config: logs.FileParser{Pattern: "nginx"},
+			in: logs.Result{
+				Time:    "2023-03-01T00:00:00Z",
+				Message: `127.0.0.1 - - [20/Jan/2023:10:15:30 +0100] "GET /index.html HTTP/1.1" 200 612 "-" "curl/7.88.1"`,
+				Labels:  map[string]string{"path": "/var/log/nginx/access.log"},
+			},
+			want: logs.Result{
+				Time:    "2023-01-20T09:15:30Z",
+				Message: `127.0.0.1 - - [20/Jan/2023:10:15:30 +0100] "GET /index.html HTTP/1.1" 200 612 "-" "curl/7.88.1"`,
+				Labels: map[string]string{
+					"path": "/var/log/nginx/access.log", "client": "127.0.0.1", "method": "GET", "request": "/index.html",
+					"http_version": "1.1", "status": "200", "bytes": "612", "user_agent": "curl/7.88.1",
+				},
+			},
+		},
+		{
+			name:   "nginx error",
+			config: logs.FileParser{Pattern: "nginx-error"},
+			in:     logs.Result{Message: "2023/02/08 16:51:50 [notice] 1#1: exit"},
+			want: logs.Result{
+				Time:    time.Date(2023, 2, 8, 16, 51, 50, 0, time.Local).UTC().Format(time.RFC3339Nano),
+				Message: "exit",
+				Labels:  map[string]string{"level": "info", "pid": "1", "tid": "1"},
+			},
+		},
+		{
+			name:   "syslog rfc5424",
+			config: logs.FileParser{Pattern: "syslog-rfc5424"},
+			in:     logs.Result{Message: `<11>1 2023-03-09T12:29:11.52Z web-1 sshd 4213 - - Failed password for root`},
+			want: logs.Result{
+				Time:    "2023-03-09T12:29:11.52Z",
+				Message: "Failed password for root",
+				Labels:  map[string]string{"level": "error", "version": "1", "host": "web-1", "app": "sshd", "pid": "4213"},
+			},
+		},
+		{
+			name:   "grok regex",
+			config: logs.FileParser{Regex: `^%{POSINT:timestamp} %{LOGLEVEL:level} %{GREEDYDATA:message}`, TimestampLayout: "20060102150405"},
+			in:     logs.Result{Message: "20230309122911 WARNING disk almost full"},
+			want: logs.Result{
+				Time:    time.Date(2023, 3, 9, 12, 29, 11, 0, time.Local).UTC().Format(time.RFC3339Nano),
+				Message: "disk almost full",
+				Labels:  map[string]string{"level": "warn"},
+			},
+		},
+		{
+			name:   "no match",
+			config: logs.FileParser{Pattern: "klog"},
+			in:     logs.Result{Time: "2023-03-01T00:00:00Z", Message: "not a klog line"},
+			want:   logs.Result{Time: "2023-03-01T00:00:00Z", Message: "not a klog line"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := newLineParser(&tt.config)
+			if err != nil {
+				t.Fatalf("newLineParser() error = %v", err)
+			}
+			if got := parser.parse(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLineParser(t *testing.T) {
+	invalid := []logs.FileParser{
+		{},
+		{Pattern: "iis"},
+		{Pattern: "nginx", Regex: `(?P<x>.*)`},
+		{Regex: `%{UNKNOWN:x}`},
+		{Regex: `(?P<x>`},
+	}
+	for _, config := range invalid {
+		if _, err := newLineParser(&config); err == nil {
+			t.Errorf("newLineParser(%+v) expected an error", config)
+		}
+	}
+
+	if parser, err := newLineParser(nil); parser != nil || err != nil {
+		t.Errorf("newLineParser(nil) = %v, %v, want no parser", parser, err)
+	}
+}
@@ -0,0 +1,124 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+)
+
+// lineSource returns the lines of a file backwards, with the offset each line starts at.
+// io.EOF is returned once the start of the file is reached.
+type lineSource interface {
+	readLine() (string, int64, error)
+}
+
+// backwardReader reads the lines of a file backwards, from an offset to the start of the file,
+// a block at a time, so reading the end of a file doesn't read the rest of it.
+type backwardReader struct {
+	file io.ReaderAt
+	// offset of the start of the buffer in the file
+	offset int64
+	// buf holds the content of the file that hasn't been returned, up to the end offset
+	buf []byte
+}
+
+// newBackwardReader returns a reader of the lines of the file that end before the offset,
+// which is the start of a line or the end of the file.
+func newBackwardReader(file io.ReaderAt, end int64) *backwardReader {
+	return &backwardReader{file: file, offset: end}
+}
+
+func (t *backwardReader) readLine() (string, int64, error) {
+	for {
+		// The newline at the end of the buffer ends the line that is returned
+		content := t.buf
+		if n := len(content); n > 0 && content[n-1] == '\n' {
+			content = content[:n-1]
+		}
+
+		if i := bytes.LastIndexByte(content, '\n'); i >= 0 {
+			t.buf = t.buf[:i+1]
+			return string(content[i+1:]), t.offset + int64(i+1), nil
+		}
+
+		if t.offset == 0 {
+			if len(t.buf) == 0 {
+				return "", 0, io.EOF
+			}
+			t.buf = nil
+			return string(content), 0, nil
+		}
+
+		size := int64(seekBlockSize)
+		if t.offset < size {
+			size = t.offset
+		}
+		block := make([]byte, size+int64(len(t.buf)))
+		if _, err := t.file.ReadAt(block[:size], t.offset-size); err != nil && err != io.EOF {
+			return "", 0, err
+		}
+		copy(block[size:], t.buf)
+		t.offset -= size
+		t.buf = block
+	}
+}
+
+// bufferedLines returns the lines of content that can only be read forward, like the content
+// of compressed files, backwards. The lines are held in memory.
+type bufferedLines struct {
+	lines   []string
+	offsets []int64
+}
+
+// newBufferedLines reads the lines of the content that start before the end offset.
+func newBufferedLines(content io.Reader, end int64) (*bufferedLines, error) {
+	t := &bufferedLines{}
+	reader := bufio.NewReader(content)
+	var offset int64
+	for offset < end {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			t.lines = append(t.lines, line)
+			t.offsets = append(t.offsets, offset)
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func (t *bufferedLines) readLine() (string, int64, error) {
+	n := len(t.lines)
+	if n == 0 {
+		return "", 0, io.EOF
+	}
+
+	line, offset := t.lines[n-1], t.offsets[n-1]
+	t.lines, t.offsets = t.lines[:n-1], t.offsets[:n-1]
+	return line, offset, nil
+}
+
+// timestampBefore returns the timestamp of the last line with one that starts before the offset.
+func timestampBefore(file io.ReaderAt, offset int64, timestamp *lineTimestamp) (time.Time, bool) {
+	if timestamp == nil {
+		return time.Time{}, false
+	}
+
+	reader := newBackwardReader(file, offset)
+	for {
+		line, _, err := reader.readLine()
+		if err != nil {
+			return time.Time{}, false
+		}
+		if ts, ok := timestamp.find(line); ok {
+			return ts, true
+		}
+	}
+}
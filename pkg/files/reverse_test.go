@@ -0,0 +1,52 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackwardReader(t *testing.T) {
+	var content bytes.Buffer
+	var lines []string
+	var offsets []int64
+	for i := 0; i < 5000; i++ {
+		line := fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%97))
+		lines = append(lines, line)
+		offsets = append(offsets, int64(content.Len()))
+		content.WriteString(line + "\n")
+	}
+	content.WriteString("partial")
+
+	reader := newBackwardReader(bytes.NewReader(content.Bytes()), offsets[4000])
+	var got []string
+	for {
+		line, offset, err := reader.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("readLine() error = %v", err)
+		}
+		if want := offsets[3999-len(got)]; offset != want {
+			t.Fatalf("readLine() offset = %d, want %d", offset, want)
+		}
+		got = append(got, line)
+	}
+
+	var want []string
+	for i := 3999; i >= 0; i-- {
+		want = append(want, lines[i])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readLine() read %d lines, want the %d lines before the offset backwards", len(got), len(want))
+	}
+
+	reader = newBackwardReader(bytes.NewReader(content.Bytes()), int64(content.Len()))
+	if line, _, _ := reader.readLine(); line != "partial" {
+		t.Errorf("readLine() = %q, want the partial line at the end of the file", line)
+	}
+}
@@ -0,0 +1,167 @@
+package files
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressionExtensions are the extensions of the compressed files, removed to find their rotation family.
+var compressionExtensions = []string{".gz", ".zst", ".bz2", ".xz"}
+
+// rotationSuffix is the suffix of rotated files after the name of the file they were rotated from:
+// the number of the rotation, as in app.log.1, or the date, and hour, of the rotation, as in app.log-20230309,
+// app.log-2023030912 or app.log.2023-03-09. Other numbers, as in node-1.log or worker-2, aren't rotations.
+var rotationSuffix = regexp.MustCompile(`(?:\.(\d{1,4})|[.-](\d{8}(?:\d{2})?|\d{4}-\d{2}-\d{2}))$`)
+
+// dateSuffixLength is the length from which a rotation suffix is a date rather than a number.
+const dateSuffixLength = 8
+
+// rotatedFile is a file of a rotation family.
+type rotatedFile struct {
+	path string
+	// family is the path of the file the family was rotated from
+	family string
+	// rotation is the number or the date of the rotation, or empty for the file that is written to
+	rotation string
+}
+
+func newRotatedFile(path string) rotatedFile {
+	family := path
+	for _, ext := range compressionExtensions {
+		if trimmed, ok := strings.CutSuffix(family, ext); ok {
+			family = trimmed
+			break
+		}
+	}
+
+	var rotation string
+	dir, name := filepath.Split(family)
+	if match := rotationSuffix.FindStringSubmatch(name); match != nil && len(match[0]) < len(name) {
+		rotation = match[1]
+		if date := strings.ReplaceAll(match[2], "-", ""); date != "" {
+			if _, err := time.Parse("20060102", date[:dateSuffixLength]); err == nil {
+				rotation = date
+			}
+		}
+		if rotation != "" {
+			family = dir + name[:len(name)-len(match[0])]
+		}
+	}
+
+	return rotatedFile{path: path, family: family, rotation: rotation}
+}
+
+// before reports whether the file was rotated before the other file of its family.
+// Numbered rotations are older the larger their number, dated rotations the older their date,
+// and the file that is written to is the newest of them.
+func (t rotatedFile) before(other rotatedFile) bool {
+	if t.rotation == "" || other.rotation == "" {
+		return other.rotation == "" && t.rotation != ""
+	}
+
+	dated, otherDated := len(t.rotation) >= dateSuffixLength, len(other.rotation) >= dateSuffixLength
+	if dated != otherDated {
+		return dated
+	}
+
+	n, _ := strconv.ParseUint(t.rotation, 10, 64)
+	otherN, _ := strconv.ParseUint(other.rotation, 10, 64)
+	if dated {
+		return n < otherN
+	}
+	return n > otherN
+}
+
+// rotationFamilies groups the paths by the file they were rotated from, e.g. app.log, app.log.1 and app.log.2.gz,
+// with the files of a family in chronological order, the file that is written to last.
+// Families are in the order of the first of their paths.
+func rotationFamilies(paths []string) [][]string {
+	var order []string
+	families := make(map[string][]rotatedFile)
+	for _, path := range paths {
+		file := newRotatedFile(path)
+		if _, ok := families[file.family]; !ok {
+			order = append(order, file.family)
+		}
+		families[file.family] = append(families[file.family], file)
+	}
+
+	grouped := make([][]string, 0, len(order))
+	for _, family := range order {
+		files := families[family]
+		sort.SliceStable(files, func(i, j int) bool { return files[i].before(files[j]) })
+
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, file.path)
+		}
+		grouped = append(grouped, paths)
+	}
+
+	return grouped
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+var compressionMagics = [][]byte{gzipMagic, zstdMagic, bzip2Magic, xzMagic}
+
+// compressionMagic returns the magic number of the compression of the file, from its first bytes,
+// or nil when it isn't compressed.
+func compressionMagic(file io.ReaderAt) []byte {
+	magic := make([]byte, len(xzMagic))
+	n, _ := file.ReadAt(magic, 0)
+	for _, m := range compressionMagics {
+		if bytes.HasPrefix(magic[:n], m) {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// isCompressed reports whether the file is compressed with gzip, zstd, bzip2 or xz.
+func isCompressed(file io.ReaderAt) bool {
+	return compressionMagic(file) != nil
+}
+
+// decompress returns a reader of the decompressed content of the file, which is compressed
+// with gzip, zstd, bzip2 or xz, or of the file itself when it isn't compressed.
+func decompress(file io.ReaderAt, size int64) (io.ReadCloser, error) {
+	content := io.NewSectionReader(file, 0, size)
+	switch magic := compressionMagic(file); {
+	case bytes.Equal(magic, gzipMagic):
+		return gzip.NewReader(content)
+	case bytes.Equal(magic, zstdMagic):
+		decoder, err := zstd.NewReader(content)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case bytes.Equal(magic, bzip2Magic):
+		return io.NopCloser(bzip2.NewReader(content)), nil
+	case bytes.Equal(magic, xzMagic):
+		reader, err := xz.NewReader(content)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	}
+
+	return io.NopCloser(content), nil
+}
@@ -0,0 +1,109 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestRotationFamilies(t *testing.T) {
+	paths := []string{
+		"/var/log/app.log",
+		"/var/log/app.log.1",
+		"/var/log/syslog-20230309.gz",
+		"/var/log/app.log.10.gz",
+		"/var/log/app.log.2.zst",
+		"/var/log/syslog",
+		"/var/log/syslog-20230308.gz",
+		"/var/log/node-1.log",
+		"/var/log/node-2.log",
+		"/var/log/worker-1",
+		"/var/log/worker-2",
+		"/var/log/api.log.2023-03-09",
+		"/var/log/api.log",
+		"/var/log/api.log.2023-03-08.gz",
+		"/var/log/build-12345678",
+	}
+
+	got := rotationFamilies(paths)
+	want := [][]string{
+		{"/var/log/app.log.10.gz", "/var/log/app.log.2.zst", "/var/log/app.log.1", "/var/log/app.log"},
+		{"/var/log/syslog-20230308.gz", "/var/log/syslog-20230309.gz", "/var/log/syslog"},
+		{"/var/log/node-1.log"},
+		{"/var/log/node-2.log"},
+		{"/var/log/worker-1"},
+		{"/var/log/worker-2"},
+		{"/var/log/api.log.2023-03-08.gz", "/var/log/api.log.2023-03-09", "/var/log/api.log"},
+		{"/var/log/build-12345678"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rotationFamilies() = %v, want %v", got, want)
+	}
+}
+
+func TestReadFamilyRotated(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, compress func(io.Writer) io.WriteCloser, content string) {
+		var buf bytes.Buffer
+		w := compress(&buf)
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain := func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} }
+	write("app.log.3.xz", func(w io.Writer) io.WriteCloser {
+		xw, _ := xz.NewWriter(w)
+		return xw
+	}, "2023-03-09T10:00:00Z first\n")
+	write("app.log.2.zst", func(w io.Writer) io.WriteCloser {
+		zw, _ := zstd.NewWriter(w)
+		return zw
+	}, "2023-03-09T11:00:00Z second\n")
+	write("app.log.1.gz", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, "2023-03-09T12:00:00Z third\n  continued\n")
+	write("app.log", plain, "  still continued\n2023-03-09T13:00:00Z fourth\n2023-03-09T14:00:00Z fifth\n")
+
+	end := time.Date(2023, 3, 9, 13, 30, 0, 0, time.UTC)
+	family := rotationFamilies(unfoldGlobs([]string{filepath.Join(dir, "app.log*")}))[0]
+	read, err := readFamily(context.Background(), family, nil, true, readOptions{end: &end})
+	if err != nil {
+		t.Fatalf("readFamily() error = %v", err)
+	}
+
+	var got []string
+	for _, line := range read.results {
+		got = append(got, line.Time+" "+line.Message)
+	}
+	want := []string{
+		"2023-03-09T10:00:00Z 2023-03-09T10:00:00Z first",
+		"2023-03-09T11:00:00Z 2023-03-09T11:00:00Z second",
+		"2023-03-09T12:00:00Z 2023-03-09T12:00:00Z third",
+		"2023-03-09T12:00:00Z continued",
+		"2023-03-09T12:00:00Z still continued",
+		"2023-03-09T13:00:00Z 2023-03-09T13:00:00Z fourth",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readFamily() = %v, want %v", got, want)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
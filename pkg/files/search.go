@@ -2,73 +2,682 @@ package files
 
 import (
 	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
 	"github.com/flanksource/commons/collections"
 	"github.com/flanksource/commons/logger"
 )
 
-func NewFileSearchBackend(config *logs.FileSearchBackendConfig) *FileSearch {
-	return &FileSearch{
-		config: config,
+func NewFileSearchBackend(config *logs.FileSearchBackendConfig) (*FileSearch, error) {
+	parser, err := newLineParser(config.Parser)
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp *lineTimestamp
+	if config.TimestampLayout != "" {
+		if timestamp, err = newLineTimestamp(config.TimestampLayout); err != nil {
+			return nil, err
+		}
 	}
+
+	var multiline *logs.Multiline
+	if config.Multiline != nil {
+		if multiline, err = config.Multiline.Compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileSearch{
+		config:    config,
+		parser:    parser,
+		timestamp: timestamp,
+		indexer:   newFileIndexer(config.Index),
+		multiline: multiline,
+	}, nil
 }
 
 type FileSearch struct {
 	config *logs.FileSearchBackendConfig
+	parser *lineParser
+
+	// timestamp finds the timestamps of the lines in the configured layout.
+	// The layout is detected for every file when it isn't configured.
+	timestamp *lineTimestamp
+
+	// indexer maintains the sparse time indexes of the files, when enabled
+	indexer *fileIndexer
+
+	// multiline folds the continuation lines of multiline events into their first line
+	multiline *logs.Multiline
+
+	// remote are the hosts the files are read from over SSH, when set
+	remote *remoteHosts
+}
+
+// Capabilities of the files backend. The lines are read, parsed and matched against the search
+// from the end of the files backwards, or from the start of the time window forward, up to the limit,
+// so only the facets are counted after the search.
+//
+// The lines of remote files aren't paged.
+func (t *FileSearch) Capabilities() logs.Capabilities {
+	if t.remote != nil {
+		return logs.Capabilities{TimeRange: true, Query: true, Labels: true, Limit: true, Parse: true}
+	}
+	return logs.Capabilities{TimeRange: true, Query: true, Labels: true, Limit: true, Page: true, Parse: true}
 }
 
-func (t *FileSearch) Search(q *logs.SearchParams) (r logs.SearchResults, err error) {
+// Search returns the newest lines of the files that match the search, or the oldest ones when sorted in ascending order.
+//
+// Every rotation family of the files, e.g. app.log, app.log.1 and app.log.2.gz, is read as one stream
+// up to the limit, starting from its position in the page token, and the families are merged.
+// The next page token holds the position after the last line returned of every family
+// that hasn't been read to its end, so paging through large files reads them once.
+func (t *FileSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	if t.remote != nil {
+		return t.searchRemote(ctx, q)
+	}
+
 	var res logs.SearchResults
-	lines := readFilesLines(t.config.Paths, collections.MergeMap(t.config.Labels, q.Labels))
-	for _, content := range lines {
-		res.Results = append(res.Results, content...)
+	positions, err := parsePageToken(q.Page)
+	if err != nil {
+		return res, err
+	}
+
+	node, err := query.Parse(q.Query)
+	if err != nil {
+		return res, err
+	}
+
+	opts := readOptions{
+		labels:    t.config.Labels,
+		parser:    t.parser,
+		parse:     t.config.Parse,
+		timestamp: t.timestamp,
+		indexer:   t.indexer,
+		multiline: t.multiline,
+		start:     q.GetStart(),
+		end:       q.GetEnd(),
+		match: func(r logs.Result) bool {
+			return q.InTimeRange(r) && q.MatchLabels(r) && query.Matches(node, r)
+		},
+		limit:      minLimit(q.Limit, q.LimitPerItem),
+		limitBytes: minLimit(q.LimitBytes, q.LimitBytesPerItem),
 	}
 
+	var reads []familyRead
+	var streams [][]logs.Result
+	for _, family := range rotationFamilies(unfoldGlobs(t.config.Paths)) {
+		var from *filePosition
+		if q.Page != "" {
+			position, ok := positions[newRotatedFile(family[0]).family]
+			if !ok {
+				// The family was read to its end by the previous pages
+				continue
+			}
+			from = &position
+		}
+
+		read, err := readFamily(ctx, family, from, q.Sort == logs.SortAscending, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			logger.Warnf("error reading files. path=%s; %v", family[len(family)-1], err)
+			continue
+		}
+		reads = append(reads, read)
+		streams = append(streams, read.results)
+	}
+
+	merged := logs.MergeResults(q.Sort, q.Limit, q.LimitBytes, streams...)
+	res.Results = merged.Results
+
+	var next []string
+	for i, read := range reads {
+		switch {
+		case merged.Consumed[i] == 0 && (read.more || len(read.results) > 0):
+			next = append(next, read.from.String())
+		case merged.Consumed[i] < len(read.results) || read.more:
+			// The cursor of a line is the position the lines after it are read from
+			next = append(next, merged.Cursors[i])
+		}
+	}
+	res.NextPage = strings.Join(next, ",")
+
 	return res, nil
 }
 
-func (t *FileSearch) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
-	return t.config.CommonBackend.Routes.MatchRoute(q)
+// minLimit returns the smallest of the limits that are set, or 0 when none is.
+func minLimit(limits ...int64) int64 {
+	var min int64
+	for _, limit := range limits {
+		if limit > 0 && (min == 0 || limit < min) {
+			min = limit
+		}
+	}
+
+	return min
+}
+
+// readOptions are how the lines of files are read.
+type readOptions struct {
+	// labels of the backend are attached to every line
+	labels map[string]string
+	// parser parses the lines into labels
+	parser *lineParser
+	// parse parses the messages of the lines into labels, after the parser
+	parse *logs.ParseConfig
+	// timestamp finds the timestamps of the lines, detected for every file when nil
+	timestamp *lineTimestamp
+	// indexer holds the sparse time indexes of the uncompressed files, when enabled
+	indexer *fileIndexer
+	// multiline folds the continuation lines of multiline events into their first line, when set
+	multiline *logs.Multiline
+	// start and end of the time window of the lines, when set
+	start, end *time.Time
+	// match reports whether a parsed line matches the search
+	match func(logs.Result) bool
+	// limit and limitBytes are the maximum number of lines, and of bytes of their messages, read from a family
+	limit, limitBytes int64
+}
+
+// fileLabels returns the labels of the backend with the label of where the lines are read from,
+// which the labels of the backend don't override.
+func fileLabels(labels map[string]string, key, value string) map[string]string {
+	return collections.MergeMap(collections.MergeMap(map[string]string{}, labels), map[string]string{key: value})
+}
+
+// result returns the parsed line, whose cursor is the position the next lines are read from.
+// Only the first line of a multiline event is parsed, its continuation lines are appended to its message.
+func (t readOptions) result(path string, labels map[string]string, line, lineTime string, cursor int64) logs.Result {
+	first, continuation, multiline := strings.Cut(line, "\n")
+	r := t.parser.parse(logs.Result{
+		Time:    lineTime,
+		Labels:  labels,
+		Message: first,
+	})
+	if t.parse != nil {
+		r = t.parse.Parse(r)
+	}
+	if multiline {
+		r.Message += "\n" + continuation
+	}
+	r.Cursor = filePosition{path: path, offset: cursor}.String()
+
+	return r
+}
+
+// add adds the result to the read when it matches the search,
+// and reports whether the limits of the read have been reached.
+// A read has at least one result, even when it's larger than the byte limit.
+func (t readOptions) add(read *familyRead, r logs.Result) bool {
+	if t.match != nil && !t.match(r) {
+		return false
+	}
+
+	size := int64(len(r.Message))
+	if t.limitBytes > 0 && len(read.results) > 0 && read.bytes+size > t.limitBytes {
+		read.more = true
+		return true
+	}
+
+	read.results = append(read.results, r)
+	read.bytes += size
+	if t.limit > 0 && int64(len(read.results)) >= t.limit {
+		read.more = true
+		return true
+	}
+
+	return false
+}
+
+// push adds the result of a line read forward to the read, and reports whether the limits of the read have been reached.
+// The result of the first line of a multiline event is held until the line after the event is read.
+func (t readOptions) push(read *familyRead, r logs.Result) bool {
+	if t.multiline == nil {
+		return t.add(read, r)
+	}
+
+	if t.flush(read) {
+		return true
+	}
+	read.event, read.eventLines = &r, 1
+	return false
+}
+
+// continues folds the line, read forward, into the multiline event before it when it continues the event,
+// and reports whether it did. The cursor of the event moves to the end of the line.
+func (t readOptions) continues(read *familyRead, path, line string, cursor int64) bool {
+	if read.event == nil || read.eventLines >= t.multiline.MaxLines() || !t.multiline.Continues(line) {
+		return false
+	}
+
+	read.event.Message = t.multiline.Append(read.event.Message, line)
+	read.event.Cursor = filePosition{path: path, offset: cursor}.String()
+	read.eventLines++
+	return true
+}
+
+// flush adds the multiline event held by the read, and reports whether the limits of the read have been reached.
+func (t readOptions) flush(read *familyRead) bool {
+	if read.event == nil {
+		return false
+	}
+
+	r := *read.event
+	read.event = nil
+	return t.add(read, r)
+}
+
+// fold folds the continuation lines of a multiline event read backwards, newest first, into the text of its first line.
+// The continuation lines after the maximum lines of an event are events of their own, which have the timestamp
+// of the first line, so they're added to the pending lines.
+func (t readOptions) fold(text string, continuation []pendingLine, pending *[]pendingLine) string {
+	var events []pendingLine
+	lines := 1
+	for i := len(continuation) - 1; i >= 0; i-- {
+		c := continuation[i]
+		switch {
+		case lines >= t.multiline.MaxLines():
+			events = append(events, pendingLine{path: c.path, labels: c.labels, text: strings.TrimSpace(c.text), offset: c.offset})
+			lines = 1
+		case len(events) == 0:
+			text = t.multiline.Append(text, c.text)
+			lines++
+		default:
+			events[len(events)-1].text = t.multiline.Append(events[len(events)-1].text, c.text)
+			lines++
+		}
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		*pending = append(*pending, events[i])
+	}
+	return text
+}
+
+// familyRead is what was read from a rotation family.
+type familyRead struct {
+	results []logs.Result
+	bytes   int64
+
+	// event is the multiline event being read forward and eventLines the number of its lines
+	event      *logs.Result
+	eventLines int
+
+	// from is the position the family was read from
+	from filePosition
+	// more is set when the read stopped at its limits before the end of the family
+	more bool
+}
+
+// readFamily reads the lines of the rotation family, whose files are ordered from the oldest to the newest,
+// that match the search, from the position or from the end of the family, backwards, or from its start when ascending.
+func readFamily(ctx context.Context, family []string, from *filePosition, ascending bool, opts readOptions) (familyRead, error) {
+	first := len(family) - 1
+	if ascending {
+		first = 0
+	}
+	if from != nil {
+		first = -1
+		for i, path := range family {
+			if path == from.path {
+				first = i
+			}
+		}
+		if first < 0 {
+			return familyRead{}, fmt.Errorf("file %s of the page token no longer exists", from.path)
+		}
+	}
+
+	if ascending {
+		return readFamilyForward(ctx, family[first:], from, opts)
+	}
+	return readFamilyBackward(ctx, family[:first+1], from, opts)
+}
+
+// readFamilyForward reads the lines of the files, from the oldest to the newest,
+// from the position or from the start of the time window to its end.
+func readFamilyForward(ctx context.Context, files []string, from *filePosition, opts readOptions) (familyRead, error) {
+	read := familyRead{from: filePosition{path: files[0]}}
+	if from != nil {
+		read.from = *from
+	}
+
+	// The timestamp of the last line with one, which the lines without one have
+	var lineTime string
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return read, err
+		}
+
+		var offset int64
+		if path == read.from.path {
+			offset = read.from.offset
+		}
+
+		ended, err := readFileForward(path, offset, &lineTime, opts, &read)
+		if err != nil {
+			return read, err
+		}
+		if ended || read.more {
+			break
+		}
+	}
+
+	if !read.more {
+		opts.flush(&read)
+	}
+	return read, nil
+}
+
+// readFileForward reads the lines of the file from the offset, decompressing files compressed with gzip, zstd, bzip2 or xz,
+// and reports whether a line after the end of the time window was read.
+//
+// Files last modified before the start of the time window are skipped. When the lines have timestamps,
+// the start of the window in an uncompressed file is found with a binary search as the lines are assumed to be in time order.
+func readFileForward(path string, offset int64, lineTime *string, opts readOptions, read *familyRead) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	fInfo, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if opts.start != nil && fInfo.ModTime().Before(*opts.start) {
+		*lineTime = fInfo.ModTime().UTC().Format(time.RFC3339Nano)
+		return false, nil
+	}
+
+	compressed := isCompressed(file)
+	content, err := decompress(file, fInfo.Size())
+	if err != nil {
+		return false, err
+	}
+	defer content.Close()
+
+	reader := bufio.NewReaderSize(content, seekBlockSize)
+	timestamp := opts.timestamp
+	if timestamp == nil {
+		timestamp = peekTimestamp(reader)
+	}
+
+	// The partial line at the offset found by the binary search, and the lines
+	// before the first timestamp after it, are before the start
+	seeked := false
+	var position int64
+	if !compressed {
+		if timestamp != nil && opts.start != nil {
+			index := opts.indexer.index(file, path, fInfo.Size(), timestamp)
+			start, err := seekTime(file, fInfo.Size(), timestamp, index, *opts.start)
+			if err != nil {
+				return false, err
+			}
+			if start > offset {
+				offset, seeked = start, true
+			}
+		}
+
+		if offset > 0 {
+			if !seeked {
+				if ts, ok := timestampBefore(file, offset, timestamp); ok {
+					*lineTime = ts.UTC().Format(time.RFC3339Nano)
+				}
+			}
+			reader.Reset(io.NewSectionReader(file, offset, fInfo.Size()-offset))
+			position = offset
+		}
+	}
+
+	// All lines of the same file will share these labels
+	labels := fileLabels(opts.labels, "path", path)
+
+	found := false
+	for first := true; ; first = false {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		lineStart := position
+		position += int64(len(line))
+
+		if line != "" && !(seeked && first) {
+			text := strings.TrimSpace(line)
+			if ts, ok := timestamp.find(text); ok {
+				if opts.end != nil && ts.After(*opts.end) {
+					return true, nil
+				}
+				*lineTime = ts.UTC().Format(time.RFC3339Nano)
+				found = true
+			}
+
+			switch {
+			case compressed && lineStart < offset:
+				// Compressed files are read from their start up to the offset
+			case seeked && !found:
+			case opts.multiline != nil && opts.continues(read, path, line, position):
+			default:
+				t := *lineTime
+				if t == "" {
+					t = fInfo.ModTime().Format(time.RFC3339)
+				}
+				if opts.push(read, opts.result(path, labels, text, t, position)) {
+					return false, nil
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return false, nil
+		}
+	}
 }
 
-type logsPerFile map[string][]logs.Result
+// pendingLine is a line without a timestamp, read backwards, that has the timestamp of the line before it,
+// or a continuation line of a multiline event that is held until the first line of its event is read.
+type pendingLine struct {
+	path   string
+	labels map[string]string
+	text   string
+	offset int64
+}
 
-// readFilesLines takes a list of file paths and returns each lines of those files.
-// If labels are also passed, it'll attach those labels to each lines of those files.
-func readFilesLines(paths []string, labelsToAttach map[string]string) logsPerFile {
-	fileContents := make(logsPerFile, len(paths))
-	for _, path := range unfoldGlobs(paths) {
-		fInfo, err := os.Stat(path)
+// readFamilyBackward reads the lines of the files, from the newest to the oldest,
+// from the position or from the end of the time window to its start.
+//
+// Lines without a timestamp have the timestamp of the line before them, so they're held
+// until that line is read, or have the modification time of their file at the start of the family.
+func readFamilyBackward(ctx context.Context, files []string, from *filePosition, opts readOptions) (familyRead, error) {
+	var read familyRead
+	if from != nil {
+		read.from = *from
+	} else {
+		newest := files[len(files)-1]
+		fInfo, err := os.Stat(newest)
 		if err != nil {
-			logger.Warnf("error get file stat. path=%s; %w", path, err)
-			continue
+			return read, err
 		}
+		read.from = filePosition{path: newest, offset: fInfo.Size()}
+	}
 
-		file, err := os.Open(path)
+	var pending, continuation []pendingLine
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return read, err
+		}
+
+		done, err := readFileBackward(files[i], read.from, &pending, &continuation, opts, &read)
 		if err != nil {
-			logger.Warnf("error opening file. path=%s; %w", path, err)
-			continue
+			return read, err
+		}
+		if done {
+			return read, nil
+		}
+	}
+
+	// The oldest line of a multiline event without a first line is its first line
+	if n := len(continuation); n > 0 {
+		first := continuation[n-1]
+		first.text = opts.fold(strings.TrimSpace(first.text), continuation[:n-1], &pending)
+		pending = append(pending, first)
+	}
+
+	for _, p := range pending {
+		modTime := time.Now()
+		if fInfo, err := os.Stat(p.path); err == nil {
+			modTime = fInfo.ModTime()
+		}
+		if opts.add(&read, opts.result(p.path, p.labels, p.text, modTime.Format(time.RFC3339), p.offset)) {
+			break
+		}
+	}
+
+	return read, nil
+}
+
+// readFileBackward reads the lines of the file backwards, from the position when it's in the file or from its end,
+// and reports whether the read is done: when the limits were reached or a line before the start of the time window was read.
+//
+// Compressed files are decompressed into memory. Only the part of uncompressed files
+// after the start of the time window is read. The continuation lines of multiline events
+// are held until the first line of their event is read.
+func readFileBackward(path string, from filePosition, pending, continuation *[]pendingLine, opts readOptions, read *familyRead) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	fInfo, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if opts.start != nil && fInfo.ModTime().Before(*opts.start) {
+		// The lines of this file, and of the older ones, are before the start
+		*pending, *continuation = nil, nil
+		return true, nil
+	}
+
+	var timestamp *lineTimestamp
+	var source lineSource
+	if isCompressed(file) {
+		content, err := decompress(file, fInfo.Size())
+		if err != nil {
+			return false, err
 		}
+		defer content.Close()
 
-		// All lines of the same file will share these labels
-		labels := collections.MergeMap(map[string]string{"path": path}, labelsToAttach)
+		reader := bufio.NewReaderSize(content, seekBlockSize)
+		if timestamp = opts.timestamp; timestamp == nil {
+			timestamp = peekTimestamp(reader)
+		}
+		// The offsets of compressed files are offsets in their decompressed content
+		end := int64(math.MaxInt64)
+		if path == from.path {
+			end = from.offset
+		}
+		if source, err = newBufferedLines(reader, end); err != nil {
+			return false, err
+		}
+	} else {
+		if timestamp = opts.timestamp; timestamp == nil {
+			timestamp = detectFileTimestamp(file, fInfo.Size())
+		}
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			fileContents[path] = append(fileContents[path], logs.Result{
-				Time:    fInfo.ModTime().Format(time.RFC3339),
-				Labels:  labels,
-				Message: strings.TrimSpace(scanner.Text()),
-			})
+		end := fInfo.Size()
+		if path == from.path && from.offset < end {
+			end = from.offset
 		}
+		if timestamp != nil && opts.end != nil && end == fInfo.Size() {
+			index := opts.indexer.index(file, path, end, timestamp)
+			if end, err = seekAfter(file, end, timestamp, index, *opts.end); err != nil {
+				return false, err
+			}
+		}
+		source = newBackwardReader(file, end)
 	}
 
-	return fileContents
+	// All lines of the same file will share these labels
+	labels := fileLabels(opts.labels, "path", path)
+	modTime := fInfo.ModTime().Format(time.RFC3339)
+
+	for {
+		line, offset, err := source.readLine()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if opts.multiline != nil && opts.multiline.Continues(line) {
+			*continuation = append(*continuation, pendingLine{path: path, labels: labels, text: line, offset: offset})
+			continue
+		}
+
+		text := strings.TrimSpace(line)
+		if opts.multiline != nil {
+			text = opts.fold(text, *continuation, pending)
+			*continuation = (*continuation)[:0]
+		}
+
+		if timestamp == nil {
+			// The lines of files without timestamps have the modification time of their file
+			for _, p := range *pending {
+				if opts.add(read, opts.result(p.path, p.labels, p.text, modTime, p.offset)) {
+					*pending = nil
+					return true, nil
+				}
+			}
+			*pending = (*pending)[:0]
+
+			if opts.add(read, opts.result(path, labels, text, modTime, offset)) {
+				return true, nil
+			}
+			continue
+		}
+
+		ts, ok := timestamp.find(text)
+		switch {
+		case !ok:
+			*pending = append(*pending, pendingLine{path: path, labels: labels, text: text, offset: offset})
+			continue
+		case opts.end != nil && ts.After(*opts.end):
+			*pending = nil
+			continue
+		case opts.start != nil && ts.Before(*opts.start):
+			*pending = nil
+			return true, nil
+		}
+
+		lineTime := ts.UTC().Format(time.RFC3339Nano)
+		for _, p := range *pending {
+			if opts.add(read, opts.result(p.path, p.labels, p.text, lineTime, p.offset)) {
+				*pending = nil
+				return true, nil
+			}
+		}
+		*pending = (*pending)[:0]
+
+		if opts.add(read, opts.result(path, labels, text, lineTime, offset)) {
+			return true, nil
+		}
+	}
 }
 
 func unfoldGlobs(paths []string) []string {
@@ -80,7 +689,13 @@ func unfoldGlobs(paths []string) []string {
 			continue
 		}
 
-		unfoldedPaths = append(unfoldedPaths, matched...)
+		for _, match := range matched {
+			// The indexes of the files, and the indexes being written, are never searched
+			if strings.Contains(filepath.Base(match), indexSuffix) {
+				continue
+			}
+			unfoldedPaths = append(unfoldedPaths, match)
+		}
 	}
 
 	return unfoldedPaths
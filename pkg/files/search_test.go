@@ -0,0 +1,101 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestFileSearchLabels(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	for path, content := range map[string]string{a: "a 1\na 2\n", b: "b 1\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"type": "app", "path": "overridden"}},
+		Paths:         []string{filepath.Join(dir, "*.log")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{name: "none", want: []string{"a 1", "a 2", "b 1"}},
+		{name: "path", labels: map[string]string{"path": b}, want: []string{"b 1"}},
+		{name: "backend", labels: map[string]string{"type": "app", "path": a}, want: []string{"a 1", "a 2"}},
+		{name: "missing", labels: map[string]string{"level": "error"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := search.Search(context.Background(), &logs.SearchParams{Labels: tt.labels, Sort: logs.SortAscending})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			var got []string
+			for _, r := range res.Results {
+				got = append(got, r.Message)
+				if want := filepath.Join(dir, r.Message[:1]+".log"); r.Labels["path"] != want || r.Labels["type"] != "app" || len(r.Labels) != 2 {
+					t.Errorf("Search() labels = %v, want the labels of the backend and the path %s", r.Labels, want)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTailLabels(t *testing.T) {
+	interval := TailInterval
+	TailInterval = 10 * time.Millisecond
+	defer func() { TailInterval = interval }()
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{Paths: []string{filepath.Join(dir, "*.log")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := make(chan logs.Result)
+	go search.Tail(ctx, &logs.SearchParams{Labels: map[string]string{"path": b}}, results)
+
+	time.Sleep(5 * TailInterval)
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte(filepath.Base(path)+" appended\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case r := <-results:
+		if r.Message != "b.log appended" || r.Labels["path"] != b {
+			t.Errorf("Tail() = %q %v, want only the lines of %s", r.Message, r.Labels, b)
+		}
+	case <-ctx.Done():
+		t.Fatal("Tail() didn't send the appended line")
+	}
+}
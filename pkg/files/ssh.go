@@ -0,0 +1,432 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/flanksource/commons/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultRemoteLines is the default maximum number of lines read from the end of every remote file.
+const DefaultRemoteLines = 10000
+
+// DefaultSSHTimeout is the timeout of connecting to a remote host.
+var DefaultSSHTimeout = 10 * time.Second
+
+// remoteFileHeader starts the line, written by the remote command before the lines of every file,
+// that holds the modification time of the file and its path.
+const remoteFileHeader = '\x00'
+
+// SSHCredentials are the credentials, resolved from their env vars, of an SSH connection.
+type SSHCredentials struct {
+	Username   string
+	Password   string
+	PrivateKey string
+	Passphrase string
+}
+
+// NewRemoteFileSearchBackend returns a file backend that searches the files on the hosts of the SSH connection of the config.
+func NewRemoteFileSearchBackend(config *logs.FileSearchBackendConfig, credentials SSHCredentials) (*FileSearch, error) {
+	if config.SSH == nil || len(config.SSH.Hosts) == 0 {
+		return nil, fmt.Errorf("ssh.hosts is required")
+	}
+
+	search, err := NewFileSearchBackend(config)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig, err := newSSHClientConfig(config.SSH, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := config.SSH.Lines
+	if lines <= 0 {
+		lines = DefaultRemoteLines
+	}
+	search.remote = &remoteHosts{config: clientConfig, hosts: config.SSH.Hosts, lines: lines}
+	return search, nil
+}
+
+// newSSHClientConfig authenticates with the password and the private key of the credentials
+// and trusts the hosts with one of the host keys of the connection.
+func newSSHClientConfig(conn *logs.SSHConnection, credentials SSHCredentials) (*ssh.ClientConfig, error) {
+	if credentials.Username == "" {
+		return nil, fmt.Errorf("ssh.username is required")
+	}
+
+	config := &ssh.ClientConfig{User: credentials.Username, Timeout: DefaultSSHTimeout}
+	if credentials.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if credentials.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(credentials.PrivateKey), []byte(credentials.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(credentials.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the ssh private key: %w", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if credentials.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(credentials.Password))
+	}
+	if len(config.Auth) == 0 {
+		return nil, fmt.Errorf("ssh.password or ssh.privateKey is required")
+	}
+
+	switch {
+	case len(conn.HostKeys) > 0:
+		var keys [][]byte
+		for _, hostKey := range conn.HostKeys {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+			if err != nil {
+				return nil, fmt.Errorf("invalid ssh host key %q: %w", hostKey, err)
+			}
+			keys = append(keys, key.Marshal())
+		}
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			for _, k := range keys {
+				if bytes.Equal(k, key.Marshal()) {
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown host key %s of %s", ssh.FingerprintSHA256(key), hostname)
+		}
+	case conn.InsecureIgnoreHostKey:
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("ssh.hostKeys is required unless ssh.insecureIgnoreHostKey is set")
+	}
+
+	return config, nil
+}
+
+// remoteHosts are the hosts whose files a file backend searches over SSH.
+type remoteHosts struct {
+	config *ssh.ClientConfig
+	hosts  []string
+	// lines is the maximum number of lines read from the end of every file
+	lines int
+}
+
+// searchRemote returns the lines of the files on every host that match the search.
+//
+// The files are filtered on the hosts with grep, when every line that matches the query has its terms,
+// and only the last lines of every file are read, which are then parsed and matched like the lines
+// of local files. The results aren't paged.
+func (t *FileSearch) searchRemote(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var res logs.SearchResults
+	node, err := query.Parse(q.Query)
+	if err != nil {
+		return res, err
+	}
+
+	opts := readOptions{
+		labels:    t.config.Labels,
+		parser:    t.parser,
+		parse:     t.config.Parse,
+		timestamp: t.timestamp,
+		multiline: t.multiline,
+		match: func(r logs.Result) bool {
+			return q.InTimeRange(r) && q.MatchLabels(r) && query.Matches(node, r)
+		},
+	}
+
+	// The terms are grepped for only when the lines are read as they are, otherwise
+	// a term may be in the line of a multiline event that doesn't have it, or be escaped in the line
+	var terms []string
+	exact := false
+	if t.multiline == nil && t.config.Parse == nil {
+		terms, exact = grepTerms(node)
+	}
+
+	// The limit is applied on the hosts when nothing but the query, which grep applies, filters the lines
+	lines := t.remote.lines
+	if exact && len(q.Labels) == 0 && q.Start == "" && q.End == "" && q.Limit > 0 && q.Limit < int64(lines) {
+		lines = int(q.Limit)
+	}
+	command := remoteCommand(t.config.Paths, terms, lines)
+
+	var mu sync.Mutex
+	var streams [][]logs.Result
+	var errs []error
+	var wg sync.WaitGroup
+	for _, host := range t.remote.hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			hostOpts := opts
+			hostOpts.labels = fileLabels(opts.labels, "host", host)
+
+			files, err := t.remote.run(ctx, host, command, func(stdout io.Reader) ([][]logs.Result, error) {
+				return readRemoteFiles(stdout, hostOpts)
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logger.Warnf("error reading remote files. host=%s; %v", host, err)
+				errs = append(errs, fmt.Errorf("%s: %w", host, err))
+				return
+			}
+			streams = append(streams, files...)
+		}(host)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	if len(errs) == len(t.remote.hosts) {
+		return res, errors.Join(errs...)
+	}
+
+	if q.Sort != logs.SortAscending {
+		// Lines with the same timestamp are returned in the order they're read in, backwards
+		for _, stream := range streams {
+			for i, j := 0, len(stream)-1; i < j; i, j = i+1, j-1 {
+				stream[i], stream[j] = stream[j], stream[i]
+			}
+		}
+	}
+
+	merged := logs.MergeResults(q.Sort, q.Limit, q.LimitBytes, streams...)
+	res.Results = merged.Results
+	return res, nil
+}
+
+// run runs the command on the host and reads its output.
+// The connection is closed when the context is done.
+func (t *remoteHosts) run(ctx context.Context, host, command string, read func(io.Reader) ([][]logs.Result, error)) ([][]logs.Result, error) {
+	addr := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(host, "22")
+	}
+
+	dialer := net.Dialer{Timeout: t.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	if err := session.Start(command); err != nil {
+		return nil, err
+	}
+
+	files, err := read(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files that can't be read are skipped and don't fail the search
+	if err := session.Wait(); err != nil || stderr.Len() > 0 {
+		logger.Debugf("error reading remote files. host=%s; %v: %s", host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return files, nil
+}
+
+// readRemoteFiles reads the output of the remote command into the results of every file, in time order.
+func readRemoteFiles(stdout io.Reader, opts readOptions) ([][]logs.Result, error) {
+	var files [][]logs.Result
+	var path, modTime string
+	var lines []string
+
+	flush := func() {
+		if path != "" {
+			files = append(files, readRemoteLines(path, modTime, lines, opts))
+		}
+		lines = nil
+	}
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if line[0] == remoteFileHeader {
+				flush()
+				mtime, file, _ := strings.Cut(strings.TrimSuffix(line[1:], "\n"), " ")
+				path, modTime = file, time.Now().Format(time.RFC3339)
+				if seconds, err := strconv.ParseInt(mtime, 10, 64); err == nil {
+					modTime = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+				}
+			} else {
+				lines = append(lines, strings.TrimSuffix(line, "\n"))
+			}
+		}
+
+		if err == io.EOF {
+			flush()
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readRemoteLines parses the lines of a remote file, which have the timestamp of the line before them
+// when they don't have one, or the modification time of the file.
+func readRemoteLines(path, modTime string, lines []string, opts readOptions) []logs.Result {
+	timestamp := opts.timestamp
+	if timestamp == nil {
+		sample := lines
+		if len(sample) > timestampSampleLines {
+			sample = sample[:timestampSampleLines]
+		}
+		timestamp = detectLineTimestamp(sample)
+	}
+
+	// All lines of the same file will share these labels
+	labels := fileLabels(opts.labels, "path", path)
+
+	var read familyRead
+	lineTime := modTime
+	for _, line := range lines {
+		text := strings.TrimSpace(line)
+		if ts, ok := timestamp.find(text); ok {
+			lineTime = ts.UTC().Format(time.RFC3339Nano)
+		}
+
+		if opts.multiline != nil && opts.continues(&read, path, line, 0) {
+			continue
+		}
+		opts.push(&read, opts.result(path, labels, text, lineTime, 0))
+	}
+	opts.flush(&read)
+
+	return read.results
+}
+
+// grepTerms returns the terms every line that matches the query contains, in any case,
+// and whether a line that contains them all matches the query.
+func grepTerms(node query.Node) ([]string, bool) {
+	switch n := node.(type) {
+	case nil:
+		return nil, true
+
+	case query.And:
+		var terms []string
+		exact := true
+		for _, child := range n.Nodes {
+			childTerms, childExact := grepTerms(child)
+			terms = append(terms, childTerms...)
+			exact = exact && childExact
+		}
+		return terms, exact
+
+	case query.Match:
+		if n.IsMessage() && n.Op == query.OpMatch && n.Value != "" {
+			return []string{n.Value}, true
+		}
+	}
+
+	return nil, false
+}
+
+// remoteCommand returns the shell command that writes the last lines, that contain the terms, of the files
+// matched by the globs. The lines of every file follow a header with its modification time and its path.
+// Compressed files are decompressed on the host.
+func remoteCommand(globs []string, terms []string, lines int) string {
+	var quoted []string
+	for _, glob := range globs {
+		quoted = append(quoted, shellGlob(glob))
+	}
+
+	filter := fmt.Sprintf("tail -n %d", lines)
+	for i := len(terms) - 1; i >= 0; i-- {
+		filter = "grep -iF -e " + shellQuote(terms[i]) + " | " + filter
+	}
+
+	// Uncompressed files are read from their end when they aren't grepped
+	read := `cat "$f"`
+	if len(terms) == 0 {
+		read = fmt.Sprintf(`tail -n %d "$f"`, lines)
+	}
+
+	return fmt.Sprintf(`for f in %s; do
+	[ -f "$f" ] || continue
+	case "$f" in *%s) continue ;; esac
+	printf '\000%%s %%s\n' "$(stat -c %%Y "$f" 2>/dev/null || stat -f %%m "$f")" "$f"
+	case "$f" in
+	*.gz) gzip -dc "$f" ;;
+	*.zst) zstd -dc "$f" ;;
+	*.bz2) bzip2 -dc "$f" ;;
+	*.xz) xz -dc "$f" ;;
+	*) %s ;;
+	esac | %s
+done`, strings.Join(quoted, " "), indexSuffix+"*", read, filter)
+}
+
+// shellGlob quotes the glob for the shell, except for its wildcards.
+func shellGlob(glob string) string {
+	var b, literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			b.WriteString(shellQuote(literal.String()))
+			literal.Reset()
+		}
+	}
+
+	for _, c := range glob {
+		if strings.ContainsRune("*?[]", c) {
+			flush()
+			b.WriteRune(c)
+			continue
+		}
+		literal.WriteRune(c)
+	}
+	flush()
+
+	return b.String()
+}
+
+// shellQuote quotes the value for the shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
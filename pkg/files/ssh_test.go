@@ -0,0 +1,209 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer starts an SSH server, standing in for a remote host, that runs the commands
+// of the sessions with sh on the local host. It returns its address and its host key.
+func startSSHServer(t *testing.T, password string) (string, string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if conn.User() == "apm" && string(p) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+
+	return listener.Addr().String(), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" || len(req.Payload) < 4 {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				cmd := exec.Command("sh", "-c", string(req.Payload[4:4+binary.BigEndian.Uint32(req.Payload)]))
+				cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+				status := make([]byte, 4)
+				if err := cmd.Run(); err != nil {
+					binary.BigEndian.PutUint32(status, 1)
+				}
+				channel.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+func TestFileSearchRemote(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my logs")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	line := func(i int, message string) string {
+		return fmt.Sprintf("%s %s %d\n", base.Add(time.Duration(i)*time.Second).Format(time.RFC3339), message, i)
+	}
+
+	var rotated bytes.Buffer
+	gz := gzip.NewWriter(&rotated)
+	for i := 0; i < 5; i++ {
+		fmt.Fprint(gz, line(i, "error"))
+	}
+	gz.Close()
+	var current, other string
+	for i := 5; i < 10; i++ {
+		current += line(i, "error")
+		other += line(i, "ok")
+	}
+	for name, content := range map[string][]byte{"app.log.1.gz": rotated.Bytes(), "app.log": []byte(current), "other.log": []byte(other)} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addr, hostKey := startSSHServer(t, "secret")
+	config := &logs.FileSearchBackendConfig{
+		Paths: []string{filepath.Join(dir, "*.log*")},
+		SSH:   &logs.SSHConnection{Hosts: []string{addr}, HostKeys: []string{hostKey}},
+	}
+	search, err := NewRemoteFileSearchBackend(config, SSHCredentials{Username: "apm", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := search.Search(context.Background(), &logs.SearchParams{Query: "error", Limit: 3})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	var got []string
+	for _, r := range res.Results {
+		got = append(got, r.Message[strings.IndexByte(r.Message, ' ')+1:])
+		if r.Labels["host"] != addr || r.Labels["path"] != filepath.Join(dir, "app.log") {
+			t.Errorf("Search() labels = %v, want the host and the path of the file", r.Labels)
+		}
+	}
+	if want := []string{"error 9", "error 8", "error 7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %v, want %v", got, want)
+	}
+
+	res, err = search.Search(context.Background(), &logs.SearchParams{
+		Query: `"error 3" OR ok`,
+		Sort:  logs.SortAscending,
+		Start: base.Add(3 * time.Second).Format(time.RFC3339),
+		End:   base.Add(6 * time.Second).Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	got = nil
+	for _, r := range res.Results {
+		got = append(got, r.Message[strings.IndexByte(r.Message, ' ')+1:])
+	}
+	if want := []string{"error 3", "ok 5", "ok 6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() of the compressed files in the window = %v, want %v", got, want)
+	}
+
+	// Hosts with other keys aren't trusted
+	_, otherKey := startSSHServer(t, "secret")
+	config.SSH.HostKeys = []string{otherKey}
+	search, err = NewRemoteFileSearchBackend(config, SSHCredentials{Username: "apm", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := search.Search(context.Background(), &logs.SearchParams{}); err == nil {
+		t.Errorf("Search() expected an error for an unknown host key")
+	}
+}
+
+func TestGrepTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		terms []string
+		exact bool
+	}{
+		{query: "", exact: true},
+		{query: `timeout "connection reset"`, terms: []string{"timeout", "connection reset"}, exact: true},
+		{query: "timeout AND level:error", terms: []string{"timeout"}},
+		{query: "timeout OR refused"},
+		{query: "NOT timeout"},
+	}
+
+	for _, tt := range tests {
+		node, err := query.Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		terms, exact := grepTerms(node)
+		if !reflect.DeepEqual(terms, tt.terms) || exact != tt.exact {
+			t.Errorf("grepTerms(%q) = %q, %v, want %q, %v", tt.query, terms, exact, tt.terms, tt.exact)
+		}
+	}
+}
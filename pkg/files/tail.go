@@ -0,0 +1,201 @@
+package files
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/flanksource/commons/logger"
+)
+
+// TailInterval is how often the tailed files are checked for new lines.
+var TailInterval = time.Second
+
+// Tail follows the files of the backend, like tail -f, and sends
+// the lines appended to them after the tail started.
+//
+// Only the newest file of a rotation family is followed, and files that appear after
+// the tail started are read from the start, as are files that were truncated or rotated.
+func (t *FileSearch) Tail(ctx context.Context, q *logs.SearchParams, results chan<- logs.Result) error {
+	if t.remote != nil {
+		return fmt.Errorf("tailing the files of remote hosts isn't supported")
+	}
+
+	node, err := query.Parse(q.Query)
+	if err != nil {
+		return err
+	}
+
+	opts := readOptions{
+		labels:    t.config.Labels,
+		parser:    t.parser,
+		parse:     t.config.Parse,
+		timestamp: t.timestamp,
+		multiline: t.multiline,
+		match: func(r logs.Result) bool {
+			return q.MatchLabels(r) && query.Matches(node, r)
+		},
+	}
+
+	files := make(map[string]*tailedFile)
+	for _, path := range tailedPaths(t.config.Paths) {
+		if fInfo, err := os.Stat(path); err == nil {
+			files[path] = &tailedFile{offset: fInfo.Size()}
+		}
+	}
+
+	ticker := time.NewTicker(TailInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, path := range tailedPaths(t.config.Paths) {
+			file, ok := files[path]
+			if !ok {
+				file = &tailedFile{}
+				files[path] = file
+			}
+
+			if err := readAppendedLines(ctx, path, file, opts, results); err != nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					return nil
+				}
+				logger.Warnf("error tailing file. path=%s; %v", path, err)
+			}
+		}
+	}
+}
+
+// tailedPaths returns the files matched by the globs that are written to: the newest file of every rotation family.
+func tailedPaths(globs []string) []string {
+	var paths []string
+	for _, family := range rotationFamilies(unfoldGlobs(globs)) {
+		paths = append(paths, family[len(family)-1])
+	}
+
+	return paths
+}
+
+// tailedFile is what is known of a tailed file between reads.
+type tailedFile struct {
+	// offset of the first line that hasn't been read
+	offset int64
+
+	// timestamp finds the timestamps of the lines of the file, once detected
+	timestamp *lineTimestamp
+	detected  bool
+
+	// lastTime is the timestamp of the last line with one, which the lines without one have
+	lastTime string
+
+	// read holds the multiline event being read, until a line after it is read
+	// or no line was appended since, and the results to send
+	read familyRead
+}
+
+// readAppendedLines sends the complete lines of the file, written after the offset of the tailed file,
+// that match the search once parsed, and moves the offset to the first line that hasn't been read.
+//
+// Lines are timestamped with the timestamp they have, or with the timestamp of the line before them,
+// or with the time they're read at when no line had a timestamp.
+// The continuation lines of multiline events are folded into their first line.
+func readAppendedLines(ctx context.Context, path string, tailed *tailedFile, opts readOptions, results chan<- logs.Result) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Compressed files are archives of rotated files that aren't written to
+	if isCompressed(file) {
+		return nil
+	}
+
+	if fInfo.Size() < tailed.offset {
+		logger.Debugf("file was truncated. reading from the start. path=%s", path)
+		tailed.offset = 0
+		tailed.detected = false
+	}
+	if fInfo.Size() == tailed.offset {
+		// Nothing was appended since the last read, so the multiline event being read is complete
+		opts.flush(&tailed.read)
+		return sendResults(ctx, &tailed.read, results)
+	}
+
+	timestamp := opts.timestamp
+	if timestamp == nil {
+		if !tailed.detected {
+			tailed.timestamp = detectFileTimestamp(file, fInfo.Size())
+			tailed.detected = true
+		}
+		timestamp = tailed.timestamp
+	}
+
+	if _, err := file.Seek(tailed.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	// All lines of the same file will share these labels
+	labels := fileLabels(opts.labels, "path", path)
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// A line without a newline is still being written
+			// and is read again once it's complete.
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		tailed.offset += int64(len(line))
+
+		text := strings.TrimSpace(line)
+		if ts, ok := timestamp.find(text); ok {
+			tailed.lastTime = ts.UTC().Format(time.RFC3339Nano)
+		}
+		if opts.multiline != nil && opts.continues(&tailed.read, path, line, tailed.offset) {
+			continue
+		}
+
+		lineTime := tailed.lastTime
+		if lineTime == "" {
+			lineTime = time.Now().Format(time.RFC3339)
+		}
+		opts.push(&tailed.read, opts.result(path, labels, text, lineTime, tailed.offset))
+		if err := sendResults(ctx, &tailed.read, results); err != nil {
+			return err
+		}
+	}
+}
+
+// sendResults sends the results of the read, which are then cleared.
+func sendResults(ctx context.Context, read *familyRead, results chan<- logs.Result) error {
+	for _, result := range read.results {
+		select {
+		case results <- result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	read.results, read.bytes = nil, 0
+	return nil
+}
@@ -0,0 +1,279 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timestampSampleLines is how many lines at the start of a file are used to detect the layout of its timestamps.
+const timestampSampleLines = 50
+
+// seekBlockSize is the size of the part of a file that is read, instead of searched, for the start of a search.
+const seekBlockSize = 64 * 1024
+
+// detectedLayouts are the layouts, in order of preference, detected in the lines of files.
+var detectedLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	// nginx and apache access logs
+	"02/Jan/2006:15:04:05 -0700",
+	// nginx error logs and go's log package
+	"2006/01/02 15:04:05.999999999",
+	// syslog
+	time.Stamp,
+	// klog
+	"0102 15:04:05.999999",
+}
+
+// layoutElements are the elements of go's time layouts and the regular expressions matching them,
+// longest first, so the longer elements are found before the elements they start with.
+var layoutElements = []struct {
+	element string
+	regex   string
+}{
+	{"January", `[A-Z][a-z]+`},
+	{"Monday", `[A-Z][a-z]+`},
+	{"Z07:00", `(?:Z|[+-]\d{2}:\d{2})`},
+	{"Z0700", `(?:Z|[+-]\d{4})`},
+	{"-07:00", `[+-]\d{2}:\d{2}`},
+	{"-0700", `[+-]\d{4}`},
+	{"2006", `\d{4}`},
+	{"Jan", `[A-Z][a-z]{2}`},
+	{"Mon", `[A-Z][a-z]{2}`},
+	{"MST", `[A-Z]{2,5}`},
+	{"002", `\d{3}`},
+	{"-07", `[+-]\d{2}`},
+	{"01", `\d{2}`},
+	{"02", `\d{2}`},
+	{"03", `\d{2}`},
+	{"04", `\d{2}`},
+	{"05", `\d{2}`},
+	{"06", `\d{2}`},
+	{"15", `\d{2}`},
+	{"_2", `[ \d]\d`},
+	{"PM", `[AP]M`},
+	{"pm", `[ap]m`},
+	{"1", `\d{1,2}`},
+	{"2", `\d{1,2}`},
+	{"3", `\d{1,2}`},
+	{"4", `\d{1,2}`},
+	{"5", `\d{1,2}`},
+}
+
+var fractionalSeconds = regexp.MustCompile(`^[.,](0+|9+)`)
+
+// layoutRegex returns a regular expression matching the timestamps written in the layout.
+func layoutRegex(layout string) string {
+	var regex strings.Builder
+	for rest := layout; rest != ""; {
+		if match := fractionalSeconds.FindString(rest); match != "" {
+			if match[1] == '0' {
+				regex.WriteString(fmt.Sprintf(`[.,]\d{%d}`, len(match)-1))
+			} else {
+				regex.WriteString(`(?:[.,]\d+)?`)
+			}
+			rest = rest[len(match):]
+			continue
+		}
+
+		found := false
+		for _, e := range layoutElements {
+			if strings.HasPrefix(rest, e.element) {
+				regex.WriteString(e.regex)
+				rest = rest[len(e.element):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			regex.WriteString(regexp.QuoteMeta(rest[:1]))
+			rest = rest[1:]
+		}
+	}
+
+	return regex.String()
+}
+
+// lineTimestamp finds the timestamps, written in a layout, in the lines of a file.
+type lineTimestamp struct {
+	layout string
+	regex  *regexp.Regexp
+}
+
+func newLineTimestamp(layout string) (*lineTimestamp, error) {
+	regex, err := regexp.Compile(layoutRegex(layout))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp layout %q: %w", layout, err)
+	}
+
+	return &lineTimestamp{layout: layout, regex: regex}, nil
+}
+
+// find returns the first timestamp of the line.
+func (t *lineTimestamp) find(line string) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+
+	match := t.regex.FindString(line)
+	if match == "" {
+		return time.Time{}, false
+	}
+
+	return parseLayoutTime(t.layout, match)
+}
+
+// detectLineTimestamp returns the timestamp of the detected layouts found in most of the lines,
+// or nil when none of the lines has a timestamp.
+func detectLineTimestamp(lines []string) *lineTimestamp {
+	var detected *lineTimestamp
+	var detectedCount int
+	for _, layout := range detectedLayouts {
+		timestamp, err := newLineTimestamp(layout)
+		if err != nil {
+			continue
+		}
+
+		var count int
+		for _, line := range lines {
+			if _, ok := timestamp.find(line); ok {
+				count++
+			}
+		}
+		if count > detectedCount {
+			detected, detectedCount = timestamp, count
+		}
+	}
+
+	return detected
+}
+
+// detectFileTimestamp detects the layout of the timestamps of the file from its first lines.
+func detectFileTimestamp(file io.ReaderAt, size int64) *lineTimestamp {
+	return peekTimestamp(bufio.NewReaderSize(io.NewSectionReader(file, 0, size), seekBlockSize))
+}
+
+// peekTimestamp detects the layout of the timestamps of the lines of the reader
+// from the first lines in its buffer, without reading them.
+func peekTimestamp(reader *bufio.Reader) *lineTimestamp {
+	// Fewer bytes than the size of the buffer are peeked at the end of the content
+	peeked, _ := reader.Peek(reader.Size())
+	lines := strings.Split(string(peeked), "\n")
+	if len(lines) > timestampSampleLines {
+		lines = lines[:timestampSampleLines]
+	}
+
+	return detectLineTimestamp(lines)
+}
+
+// parseLayoutTime parses a timestamp in the layout, in the local time zone when the layout has none.
+// Timestamps without a year, like the ones of syslog and klog, are assumed to be of the last twelve months.
+func parseLayoutTime(layout, value string) (time.Time, bool) {
+	ts, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if ts.Year() == 0 {
+		now := time.Now()
+		ts = time.Date(now.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), ts.Location())
+		if ts.After(now.Add(24 * time.Hour)) {
+			ts = ts.AddDate(-1, 0, 0)
+		}
+	}
+
+	return ts, true
+}
+
+// seekTime returns an offset of the file from which reading finds every line at or after the time,
+// with a binary search over the timestamps of the file. The lines of the file are assumed to be in time order.
+//
+// The offset may be in the middle of a line, and the line it's in, as any line before
+// the first line with a timestamp after it, is before the time.
+// The search starts from the part of the file the index, when set, bounds the time to.
+func seekTime(file io.ReaderAt, size int64, timestamp *lineTimestamp, index *fileIndex, at time.Time) (int64, error) {
+	low, high := index.bounds(size, at)
+	for high-low > seekBlockSize {
+		mid := low + (high-low)/2
+		ts, ok, err := firstTimestamp(file, mid, high, timestamp)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok && ts.Before(at) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return low, nil
+}
+
+// seekAfter returns the offset of the first line of the file with a timestamp after the time,
+// or the end of the file, with a binary search over the timestamps of the file.
+func seekAfter(file io.ReaderAt, size int64, timestamp *lineTimestamp, index *fileIndex, at time.Time) (int64, error) {
+	low, err := seekTime(file, size, timestamp, index, at.Add(time.Nanosecond))
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, low, size-low))
+	offset := low
+	if low > 0 {
+		// Skip the rest of the line the offset is in
+		partial, err := reader.ReadString('\n')
+		offset += int64(len(partial))
+		if err == io.EOF {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if ts, ok := timestamp.find(line); ok && ts.After(at) {
+			return offset, nil
+		}
+		offset += int64(len(line))
+		if err == io.EOF {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// firstTimestamp returns the timestamp of the first line that starts after the offset and before the limit.
+func firstTimestamp(file io.ReaderAt, offset, limit int64, timestamp *lineTimestamp) (time.Time, bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, limit-offset))
+	if offset > 0 {
+		// Skip the rest of the line the offset is in
+		if _, err := reader.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return time.Time{}, false, nil
+			}
+			return time.Time{}, false, err
+		}
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if ts, ok := timestamp.find(line); ok {
+			return ts, true, nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return time.Time{}, false, nil
+			}
+			return time.Time{}, false, err
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectLineTimestamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{
+			name:  "rfc3339",
+			lines: []string{`2023-03-09T12:29:11.52Z INFO started`, `	at main.go:12`},
+			want:  time.RFC3339Nano,
+		},
+		{
+			name:  "nginx access",
+			lines: []string{`127.0.0.1 - - [20/Jan/2023:10:15:30 +0000] "GET / HTTP/1.1" 200 612`},
+			want:  "02/Jan/2006:15:04:05 -0700",
+		},
+		{
+			name:  "nginx error",
+			lines: []string{`2023/02/08 16:51:50 [notice] 1#1: exit`},
+			want:  "2006/01/02 15:04:05.999999999",
+		},
+		{
+			name:  "syslog",
+			lines: []string{`Mar  9 12:29:11 web-1 sshd[4213]: Failed password for root`},
+			want:  time.Stamp,
+		},
+		{
+			name:  "klog",
+			lines: []string{`I0309 12:29:11.520000       1 main.go:12] started`},
+			want:  "0102 15:04:05.999999",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectLineTimestamp(tt.lines)
+			if got == nil || got.layout != tt.want {
+				t.Errorf("detectLineTimestamp() = %+v, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := detectLineTimestamp([]string{"no timestamp here"}); got != nil {
+		t.Errorf("detectLineTimestamp() = %+v, want nil", got)
+	}
+}
+
+func TestReadFamilyWindow(t *testing.T) {
+	base := time.Date(2023, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	// Every event is a line with a timestamp and a continuation line without one
+	var content strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&content, "%s event %d\n  continued %d\n", base.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i, i)
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(content.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	start, end := base.Add(5000*time.Second), base.Add(5002*time.Second)
+	read, err := readFamily(context.Background(), []string{path}, nil, true, readOptions{start: &start, end: &end})
+	if err != nil {
+		t.Fatalf("readFamily() error = %v", err)
+	}
+	lines := read.results
+
+	var inWindow int
+	for _, line := range lines {
+		ts, _ := time.Parse(time.RFC3339, line.Time)
+		if ts.After(end) {
+			t.Errorf("readFamily() read %q after the end of the window", line.Message)
+		}
+		if !ts.Before(start) {
+			inWindow++
+		}
+	}
+	if inWindow != 6 {
+		t.Errorf("readFamily() read %d lines in the window, want 6", inWindow)
+	}
+	if len(lines) > 2*seekBlockSize/40 {
+		t.Errorf("readFamily() read %d lines, want only the lines around the window", len(lines))
+	}
+
+	last := lines[len(lines)-1]
+	if want := base.Add(5002 * time.Second).Format(time.RFC3339Nano); last.Message != "continued 5002" || last.Time != want {
+		t.Errorf("readFamily() last line = %+v, want the continuation line timestamped %s", last, want)
+	}
+}
@@ -0,0 +1,216 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/flanksource/commons/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// Histogram counts the results of a search per time bucket
+// broken down by backend or by a label.
+func Histogram(c echo.Context) error {
+	cc := c.(*api.Context)
+	params := new(logs.HistogramParams)
+	if err := c.Bind(params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	params.SetDefaults()
+
+	histogram, err := HistogramBackends(c.Request().Context(), logs.GlobalBackends, params)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	logger.Infof("[%s] => %d series of %s", params.SearchParams, len(histogram.Series), histogram.Interval)
+
+	if params.Strict && histogram.HasErrors() {
+		return cc.JSON(http.StatusBadGateway, logs.Histogram{Backends: histogram.Backends})
+	}
+
+	return cc.JSON(http.StatusOK, *histogram)
+}
+
+type histogramResponse struct {
+	series   []logs.HistogramSeries
+	err      error
+	duration time.Duration
+}
+
+// HistogramBackends counts the results of the backends that match the search, concurrently,
+// and adds up their counts.
+//
+// The backends are matched like they are for a search, including additive routes.
+// Backends that can't count their results themselves are searched for every result
+// and their results are counted in memory.
+func HistogramBackends(ctx context.Context, backends []logs.SearchBackend, q *logs.HistogramParams) (*logs.Histogram, error) {
+	if q.Page != "" {
+		return nil, fmt.Errorf("histograms are not paginated")
+	}
+	if _, err := query.Parse(q.Query); err != nil {
+		return nil, err
+	}
+
+	interval, err := q.GetInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	matched, _ := planSearch(backends, &q.SearchParams, nil)
+
+	responses := make([]histogramResponse, len(matched))
+	var wg sync.WaitGroup
+	for i, m := range matched {
+		wg.Add(1)
+		go func(i int, m matchedBackend) {
+			defer wg.Done()
+			start := time.Now()
+			responses[i].series, responses[i].err = histogramRoute(ctx, m.backend, m.route, q, interval)
+			responses[i].duration = time.Since(start)
+		}(i, m)
+	}
+	wg.Wait()
+
+	histogram := &logs.Histogram{
+		Interval: interval.String(),
+		GroupBy:  q.GroupBy,
+		Backends: make([]logs.BackendStatus, len(matched)),
+	}
+	var collated []int
+	for i, m := range matched {
+		histogram.Backends[i] = logs.BackendStatus{
+			Backend:  m.backend.Name,
+			Type:     m.backend.Type,
+			Duration: responses[i].duration.Milliseconds(),
+		}
+		if responses[i].err != nil {
+			logger.Errorf("error counting backend[%s]: %v", m.backend.Name, responses[i].err)
+			histogram.Backends[i].Error = responses[i].err.Error()
+			continue
+		}
+
+		// Like a search, the counts of a backend with an additive route
+		// replace the counts of every other backend.
+		if m.route.IsAdditive {
+			for _, j := range collated {
+				histogram.Backends[j].Discarded = true
+			}
+			for j := i + 1; j < len(matched); j++ {
+				histogram.Backends[j] = logs.BackendStatus{
+					Backend:   matched[j].backend.Name,
+					Type:      matched[j].backend.Type,
+					Duration:  responses[j].duration.Milliseconds(),
+					Discarded: true,
+				}
+			}
+
+			collated = []int{i}
+			break
+		}
+
+		collated = append(collated, i)
+	}
+
+	counter := logs.NewHistogramCounter(interval)
+	for _, i := range collated {
+		counter.AddSeries(responses[i].series...)
+		for _, s := range responses[i].series {
+			for _, b := range s.Buckets {
+				histogram.Backends[i].Total += int(b.Count)
+			}
+		}
+	}
+	histogram.Series = counter.Series()
+
+	return histogram, nil
+}
+
+// histogramRoute counts the results of the searches the route's rewrite maps the search into.
+func histogramRoute(ctx context.Context, backend logs.SearchBackend, route *logs.SearchRoute, q *logs.HistogramParams, interval time.Duration) ([]logs.HistogramSeries, error) {
+	queries, err := rewriteSearch(route, withoutBackendLabel(&q.SearchParams))
+	if err != nil {
+		return nil, err
+	}
+
+	var series []logs.HistogramSeries
+	for i := range queries {
+		queries[i].Page = ""
+		counts, err := histogramBackend(ctx, backend, &logs.HistogramParams{
+			SearchParams: queries[i],
+			Interval:     q.Interval,
+			GroupBy:      q.GroupBy,
+		}, interval)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, counts...)
+	}
+
+	return series, nil
+}
+
+// histogramBackend counts the results of a single backend.
+func histogramBackend(ctx context.Context, backend logs.SearchBackend, q *logs.HistogramParams, interval time.Duration) ([]logs.HistogramSeries, error) {
+	histogrammer, ok := backend.API.(logs.Histogrammer)
+	if !ok {
+		return countResults(ctx, backend, q, interval)
+	}
+
+	timeout := backend.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBackendTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The backend label isn't a field of the backend,
+	// its counts make up a single group
+	params := *q
+	if params.GroupBy == logs.LabelBackend {
+		params.GroupBy = ""
+	}
+
+	series, err := histogrammer.Histogram(ctx, &params, interval)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		return nil, err
+	}
+
+	if q.GroupBy == logs.LabelBackend {
+		for i := range series {
+			series[i].Group = backend.Name
+		}
+	}
+
+	return series, nil
+}
+
+// countResults counts every result of the search in memory, without the limits of the search
+// and the limits per item, e.g. the lines per container of Kubernetes.
+func countResults(ctx context.Context, backend logs.SearchBackend, q *logs.HistogramParams, interval time.Duration) ([]logs.HistogramSeries, error) {
+	searchParams := q.SearchParams.Clone()
+	searchParams.Limit = 0
+	searchParams.LimitBytes = 0
+	searchParams.LimitPerItem = 0
+	searchParams.LimitBytesPerItem = 0
+	searchParams.Page = ""
+
+	results, err := searchBackend(ctx, backend, searchParams)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := logs.NewHistogramCounter(interval)
+	counter.AddResults(q.GroupBy, results.Results...)
+	return counter.Series(), nil
+}
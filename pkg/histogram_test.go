@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// staticSearch is a backend that returns the same results for every search.
+type staticSearch struct {
+	results []logs.Result
+}
+
+func (t staticSearch) Capabilities() logs.Capabilities { return logs.Capabilities{} }
+
+func (t staticSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	return logs.SearchResults{Results: t.results}, nil
+}
+
+func TestHistogramBackends(t *testing.T) {
+	route := logs.SearchRoute{Type: "KubernetesPod"}
+	backends := []logs.SearchBackend{
+		{Name: "files", Routes: logs.Routes{route}, API: staticSearch{results: []logs.Result{
+			{Time: "2023-03-09T12:00:10Z", Message: "error: refused", Labels: map[string]string{"level": "error"}},
+			{Time: "2023-03-09T12:01:10Z", Message: "started", Labels: map[string]string{"level": "info"}},
+		}}},
+		{Name: "pods", Routes: logs.Routes{route}, API: staticSearch{results: []logs.Result{
+			{Time: "2023-03-09T12:00:40Z", Message: "error: timeout", Labels: map[string]string{"level": "error"}},
+			{Time: "2023-03-09T13:00:40Z", Message: "error: too late", Labels: map[string]string{"level": "error"}},
+		}}},
+	}
+
+	q := &logs.HistogramParams{
+		SearchParams: logs.SearchParams{Type: "KubernetesPod", Start: "2023-03-09T12:00:00Z", End: "2023-03-09T12:30:00Z"},
+		Interval:     "1m",
+	}
+	q.SetDefaults()
+
+	got, err := HistogramBackends(context.Background(), backends, q)
+	if err != nil {
+		t.Fatalf("HistogramBackends() error = %v", err)
+	}
+
+	want := []logs.HistogramSeries{
+		{Group: "files", Buckets: []logs.HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 1}, {Time: "2023-03-09T12:01:00Z", Count: 1}}},
+		{Group: "pods", Buckets: []logs.HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 1}}},
+	}
+	if !reflect.DeepEqual(got.Series, want) {
+		t.Errorf("HistogramBackends() = %v, want %v", got.Series, want)
+	}
+
+	q.GroupBy = "level"
+	q.Query = "error"
+	got, err = HistogramBackends(context.Background(), backends, q)
+	if err != nil {
+		t.Fatalf("HistogramBackends() error = %v", err)
+	}
+
+	want = []logs.HistogramSeries{
+		{Group: "error", Buckets: []logs.HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 2}}},
+	}
+	if !reflect.DeepEqual(got.Series, want) {
+		t.Errorf("HistogramBackends() = %v, want %v", got.Series, want)
+	}
+}
+
+// limitedSearch is a backend that returns at most the limit per item of its results.
+type limitedSearch struct {
+	staticSearch
+}
+
+func (t limitedSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	results := t.results
+	if q.LimitPerItem > 0 && int64(len(results)) > q.LimitPerItem {
+		results = results[:q.LimitPerItem]
+	}
+	return logs.SearchResults{Results: results}, nil
+}
+
+func TestHistogramBackendsLimitPerItem(t *testing.T) {
+	route := logs.SearchRoute{Type: "KubernetesPod"}
+	var results []logs.Result
+	for i := 0; i < 150; i++ {
+		results = append(results, logs.Result{Time: "2023-03-09T12:00:10Z", Message: "started"})
+	}
+	backends := []logs.SearchBackend{{Name: "pods", Routes: logs.Routes{route}, API: limitedSearch{staticSearch{results: results}}}}
+
+	q := &logs.HistogramParams{
+		SearchParams: logs.SearchParams{Type: "KubernetesPod", Start: "2023-03-09T12:00:00Z", End: "2023-03-09T12:30:00Z"},
+		Interval:     "1m",
+	}
+	q.SetDefaults()
+
+	got, err := HistogramBackends(context.Background(), backends, q)
+	if err != nil {
+		t.Fatalf("HistogramBackends() error = %v", err)
+	}
+
+	want := []logs.HistogramSeries{{Group: "pods", Buckets: []logs.HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 150}}}}
+	if !reflect.DeepEqual(got.Series, want) {
+		t.Errorf("HistogramBackends() = %v, want %v", got.Series, want)
+	}
+}
+
+// fieldHistogram is a backend that counts the results that have every label of the search as a field.
+type fieldHistogram struct {
+	staticSearch
+}
+
+func (t fieldHistogram) Histogram(ctx context.Context, q *logs.HistogramParams, interval time.Duration) ([]logs.HistogramSeries, error) {
+	var results []logs.Result
+	for _, r := range t.results {
+		if q.MatchLabels(r) {
+			results = append(results, r)
+		}
+	}
+
+	counter := logs.NewHistogramCounter(interval)
+	counter.AddResults(q.GroupBy, results...)
+	return counter.Series(), nil
+}
+
+func TestHistogramBackendsBackendLabel(t *testing.T) {
+	route := logs.SearchRoute{Type: "KubernetesPod"}
+	backends := []logs.SearchBackend{
+		{Name: "pods", Routes: logs.Routes{route}, API: fieldHistogram{staticSearch{results: []logs.Result{
+			{Time: "2023-03-09T12:00:10Z", Message: "started", Labels: map[string]string{"level": "info"}},
+		}}}},
+		{Name: "archive", Routes: logs.Routes{route}, API: fieldHistogram{staticSearch{results: []logs.Result{
+			{Time: "2023-03-09T12:00:20Z", Message: "archived", Labels: map[string]string{"level": "info"}},
+		}}}},
+	}
+
+	q := &logs.HistogramParams{
+		SearchParams: logs.SearchParams{
+			Type:   "KubernetesPod",
+			Start:  "2023-03-09T12:00:00Z",
+			End:    "2023-03-09T12:30:00Z",
+			Labels: map[string]string{logs.LabelBackend: "pods", "level": "info"},
+		},
+		Interval: "1m",
+	}
+	q.SetDefaults()
+
+	got, err := HistogramBackends(context.Background(), backends, q)
+	if err != nil {
+		t.Fatalf("HistogramBackends() error = %v", err)
+	}
+
+	want := []logs.HistogramSeries{{Group: "pods", Buckets: []logs.HistogramBucket{{Time: "2023-03-09T12:00:00Z", Count: 1}}}}
+	if !reflect.DeepEqual(got.Series, want) {
+		t.Errorf("HistogramBackends() = %v, want %v", got.Series, want)
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/flanksource/commons/logger"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 
 	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/kommons"
@@ -35,23 +37,56 @@ func GetKubeClient(kommonsClient *kommons.Client, kubernetesSeachBackend *logs.K
 	return &Client{kommonsClient}, nil
 }
 
-func (c *Client) GetAllPodsForNode(nodeName string, labels map[string]string) (pods *v1.PodList, err error) {
+// PodSelector selects the pods to list or watch.
+type PodSelector struct {
+	// Namespace of the pods. Empty selects the pods of every namespace.
+	Namespace string
+	Options   metav1.ListOptions
+}
+
+// PodSelectorForNode selects the pods, with the labels, scheduled on the node.
+// An empty node name selects the pods of every node.
+func PodSelectorForNode(nodeName string, labels map[string]string) PodSelector {
+	selector := PodSelector{Options: metav1.ListOptions{LabelSelector: GetLabelString(labels)}}
+	if nodeName != "" {
+		selector.Options.FieldSelector = "spec.nodeName=" + nodeName
+	}
+	return selector
+}
+
+// PodSelectorForName selects the pod with the name and labels.
+// An empty name selects every pod with the labels.
+func PodSelectorForName(name, namespace string, labels map[string]string) PodSelector {
+	selector := PodSelector{Namespace: namespace, Options: metav1.ListOptions{LabelSelector: GetLabelString(labels)}}
+	if name != "" {
+		selector.Options.FieldSelector = "metadata.name=" + name
+	}
+	return selector
+}
+
+// ListPods lists the pods of the selector
+func (c *Client) ListPods(ctx context.Context, selector PodSelector) (*v1.PodList, error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
 	}
-	labelsString := GetLabelString(labels)
 
-	if nodeName != "" {
-		pods, err = client.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-			FieldSelector: "spec.nodeName=" + nodeName,
-			LabelSelector: labelsString,
-		})
-	} else {
-		pods, err = client.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-			LabelSelector: labelsString,
-		})
+	return client.CoreV1().Pods(selector.Namespace).List(ctx, selector.Options)
+}
+
+// WatchPods watches the pods of the selector.
+// The watch starts with an added event for every existing pod.
+func (c *Client) WatchPods(ctx context.Context, selector PodSelector) (watch.Interface, error) {
+	client, err := c.GetClientset()
+	if err != nil {
+		return nil, err
 	}
+
+	return client.CoreV1().Pods(selector.Namespace).Watch(ctx, selector.Options)
+}
+
+func (c *Client) GetAllPodsForNode(ctx context.Context, nodeName string, labels map[string]string) (pods *v1.PodList, err error) {
+	pods, err = c.ListPods(ctx, PodSelectorForNode(nodeName, labels))
 	if err != nil {
 		return nil, err
 	}
@@ -62,22 +97,8 @@ func (c *Client) GetAllPodsForNode(nodeName string, labels map[string]string) (p
 }
 
 // empty name will fetch all pods with the specified labels and if labels are nil will fetch the pods with the specified name
-func (c *Client) GetPodsWithNameAndLabels(name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
-	client, err := c.GetClientset()
-	if err != nil {
-		return nil, err
-	}
-	labelsString := GetLabelString(labels)
-	if name != "" {
-		pods, err = client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-			FieldSelector: "metadata.name=" + name,
-			LabelSelector: labelsString,
-		})
-	} else {
-		pods, err = client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: labelsString,
-		})
-	}
+func (c *Client) GetPodsWithNameAndLabels(ctx context.Context, name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+	pods, err = c.ListPods(ctx, PodSelectorForName(name, namespace, labels))
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +108,8 @@ func (c *Client) GetPodsWithNameAndLabels(name, namespace string, labels map[str
 	return nil, nil
 }
 
-func (c *Client) GetPodsForDeployment(name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+// GetPodSelectorsForDeployment returns a selector for the pods of every deployment with the name and labels.
+func (c *Client) GetPodSelectorsForDeployment(ctx context.Context, name, namespace string, labels map[string]string) ([]PodSelector, error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
@@ -97,28 +119,41 @@ func (c *Client) GetPodsForDeployment(name, namespace string, labels map[string]
 
 	var deployments *appsv1.DeploymentList
 	if name != "" {
-		deployments, err = client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{
+		deployments, err = client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 			FieldSelector: "metadata.name=" + name,
 		})
 	} else {
-		deployments, err = client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{
+		deployments, err = client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 		})
 	}
 	if err != nil {
 		return nil, err
 	}
-	var deploymentPod *v1.PodList
+
+	selectors := make([]PodSelector, 0, len(deployments.Items))
+	for _, deployment := range deployments.Items {
+		selectors = append(selectors, PodSelector{
+			Namespace: deployment.GetNamespace(),
+			Options:   metav1.ListOptions{LabelSelector: GetLabelString(deployment.Spec.Template.Labels)},
+		})
+	}
+	return selectors, nil
+}
+
+func (c *Client) GetPodsForDeployment(ctx context.Context, name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+	selectors, err := c.GetPodSelectorsForDeployment(ctx, name, namespace, labels)
+	if err != nil {
+		return nil, err
+	}
 	pods = &v1.PodList{
 		Items: []v1.Pod{},
 	}
-	for _, deployment := range deployments.Items {
-		deploymentPod, err = client.CoreV1().Pods(deployment.GetNamespace()).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: GetLabelString(deployment.Spec.Template.Labels),
-		})
+	for _, selector := range selectors {
+		deploymentPod, err := c.ListPods(ctx, selector)
 		if err != nil {
-			logger.Errorf("error fetching pod for deployment: %v; error: %v", deployment.Name, err)
+			logger.Errorf("error fetching pod for deployment: %v; error: %v", selector.Options.LabelSelector, err)
 			continue
 		}
 		pods.Items = append(pods.Items, deploymentPod.Items...)
@@ -126,7 +161,8 @@ func (c *Client) GetPodsForDeployment(name, namespace string, labels map[string]
 	return
 }
 
-func (c *Client) GetPodsForService(name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+// GetPodSelectorsForService returns a selector for the pods of every service with the name and labels.
+func (c *Client) GetPodSelectorsForService(ctx context.Context, name, namespace string, labels map[string]string) ([]PodSelector, error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
@@ -136,27 +172,41 @@ func (c *Client) GetPodsForService(name, namespace string, labels map[string]str
 
 	var services *v1.ServiceList
 	if name != "" {
-		services, err = client.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{
+		services, err = client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 			FieldSelector: "metadata.name=" + name,
 		})
 	} else {
-		services, err = client.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{
+		services, err = client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 		})
 	}
 	if err != nil {
 		return nil, err
 	}
+
+	selectors := make([]PodSelector, 0, len(services.Items))
+	for _, service := range services.Items {
+		selectors = append(selectors, PodSelector{
+			Namespace: service.GetNamespace(),
+			Options:   metav1.ListOptions{LabelSelector: GetLabelString(service.Spec.Selector)},
+		})
+	}
+	return selectors, nil
+}
+
+func (c *Client) GetPodsForService(ctx context.Context, name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+	selectors, err := c.GetPodSelectorsForService(ctx, name, namespace, labels)
+	if err != nil {
+		return nil, err
+	}
 	pods = &v1.PodList{
 		Items: []v1.Pod{},
 	}
-	for _, service := range services.Items {
-		servicePods, err := client.CoreV1().Pods(service.GetNamespace()).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: GetLabelString(service.Spec.Selector),
-		})
+	for _, selector := range selectors {
+		servicePods, err := c.ListPods(ctx, selector)
 		if err != nil {
-			logger.Errorf("error fetching pod for deployment: %v; error: %v", service.Name, err)
+			logger.Errorf("error fetching pod for service: %v; error: %v", selector.Options.LabelSelector, err)
 			continue
 		}
 		pods.Items = append(pods.Items, servicePods.Items...)
@@ -168,11 +218,12 @@ func getLogResult(line string) logs.Result {
 	timestamp := strings.Split(line, " ")[0]
 	return logs.Result{
 		Time:    timestamp,
-		Message: strings.TrimPrefix(line, timestamp),
+		Message: strings.TrimPrefix(line, timestamp+" "),
 	}
 }
 
-func (c *Client) GetLogsForPod(q *logs.SearchParams, pod v1.Pod) (map[string][]logs.Result, error) {
+// GetLogsForPod returns the logs of the containers of the pod that match the container filter.
+func (c *Client) GetLogsForPod(ctx context.Context, q *logs.SearchParams, pod v1.Pod, matchContainer func(name string) bool) (map[string][]logs.Result, error) {
 	containerLogs := make(map[string][]logs.Result)
 	client, err := c.GetClientset()
 	if err != nil {
@@ -181,28 +232,12 @@ func (c *Client) GetLogsForPod(q *logs.SearchParams, pod v1.Pod) (map[string][]l
 	pods := client.CoreV1().Pods(pod.Namespace)
 
 	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
-		options := &v1.PodLogOptions{
-			Container:  container.Name,
-			Follow:     false,
-			Timestamps: true,
-		}
-
-		if q.LimitPerItem > 0 {
-			options.TailLines = &q.LimitPerItem
-		} else if q.Limit > 0 {
-			options.TailLines = &q.Limit
-		}
-		if q.LimitBytesPerItem > 0 {
-			options.LimitBytes = &q.LimitBytesPerItem
-		} else if q.LimitBytes > 0 {
-			options.LimitBytes = &q.LimitBytes
-		}
-		start := q.GetStart()
-		if start != nil {
-			options.SinceTime = &metav1.Time{Time: *start}
+		if !matchContainer(container.Name) {
+			continue
 		}
 
-		podLogs, err := pods.GetLogs(pod.Name, options).Do(context.TODO()).Raw()
+		options := podLogOptions(q, container.Name, false)
+		podLogs, err := pods.GetLogs(pod.Name, options).Do(ctx).Raw()
 		if err != nil {
 			logger.Tracef("failed to begin streaming %s/%s: %s", pod.Name, container.Name, err)
 			continue
@@ -216,3 +251,39 @@ func (c *Client) GetLogsForPod(q *logs.SearchParams, pod v1.Pod) (map[string][]l
 	}
 	return containerLogs, nil
 }
+
+// StreamLogsForContainer follows the logs of a container of the pod.
+// The stream ends when the container stops or the context is done.
+func (c *Client) StreamLogsForContainer(ctx context.Context, q *logs.SearchParams, pod v1.Pod, container string) (io.ReadCloser, error) {
+	client, err := c.GetClientset()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, podLogOptions(q, container, true)).Stream(ctx)
+}
+
+func podLogOptions(q *logs.SearchParams, container string, follow bool) *v1.PodLogOptions {
+	options := &v1.PodLogOptions{
+		Container:  container,
+		Follow:     follow,
+		Timestamps: true,
+	}
+
+	if q.LimitPerItem > 0 {
+		options.TailLines = &q.LimitPerItem
+	} else if q.Limit > 0 {
+		options.TailLines = &q.Limit
+	}
+	if q.LimitBytesPerItem > 0 {
+		options.LimitBytes = &q.LimitBytesPerItem
+	} else if q.LimitBytes > 0 {
+		options.LimitBytes = &q.LimitBytes
+	}
+	start := q.GetStart()
+	if start != nil {
+		options.SinceTime = &metav1.Time{Time: *start}
+	}
+
+	return options
+}
@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelKeys returns the canonical labels of the pods and the labels of the backend.
+func (s *KubernetesSearch) LabelKeys(ctx context.Context) ([]string, error) {
+	keys := []string{logs.LabelContainer, logs.LabelNamespace, logs.LabelNode, logs.LabelPod}
+	return append(keys, s.config.LabelKeys()...), nil
+}
+
+// LabelValues returns the namespaces, pods, containers or nodes of the cluster,
+// or the value of a label of the backend.
+func (s *KubernetesSearch) LabelValues(ctx context.Context, label string) ([]string, error) {
+	if value, ok := s.config.Labels[label]; ok {
+		return []string{value}, nil
+	}
+
+	client, err := s.client.GetClientset()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	switch label {
+	case logs.LabelNamespace:
+		namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaces.Items {
+			seen[ns.Name] = true
+		}
+
+	case logs.LabelNode:
+		nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes.Items {
+			seen[node.Name] = true
+		}
+
+	case logs.LabelPod, logs.LabelContainer:
+		pods, err := s.client.ListPods(ctx, PodSelector{})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods.Items {
+			if label == logs.LabelPod {
+				seen[pod.Name] = true
+				continue
+			}
+			for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				seen[container.Name] = true
+			}
+		}
+	}
+
+	values := make([]string, 0, len(seen))
+	for v := range seen {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values, nil
+}
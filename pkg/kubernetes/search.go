@@ -1,6 +1,7 @@
 package kubernetes
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -10,96 +11,245 @@ import (
 	v1 "k8s.io/api/core/v1"
 )
 
-func NewKubernetesSearchBackend(client *Client, config *logs.KubernetesSearchBackendConfig) *KubernetesSearch {
-	return &KubernetesSearch{
-		client: client,
-		config: config,
+func NewKubernetesSearchBackend(client *Client, config *logs.KubernetesSearchBackendConfig) (*KubernetesSearch, error) {
+	var multiline *logs.Multiline
+	if config.Multiline != nil {
+		var err error
+		if multiline, err = config.Multiline.Compile(); err != nil {
+			return nil, err
+		}
 	}
+
+	return &KubernetesSearch{
+		client:    client,
+		config:    config,
+		labels:    config.GetLabelMapping(logs.BackendTypeKubernetes),
+		multiline: multiline,
+	}, nil
 }
 
 type KubernetesSearch struct {
 	client *Client
 	config *logs.KubernetesSearchBackendConfig
+	labels logs.LabelMapping
+
+	// multiline folds the continuation lines of the containers into the line before them
+	multiline *logs.Multiline
+}
+
+// podFilter selects pods, containers and lines by the canonical labels of a search
+// which, unlike other labels, are not matched against the labels of the pods.
+type podFilter struct {
+	pods       []string
+	nodes      []string
+	containers []string
+
+	// lines are the labels the lines are matched against once parsed
+	lines map[string]string
+}
+
+// getPodFilter removes the canonical labels from the search and returns the filter they make up.
+// The namespace label is left in place for GetNameNamespace.
+func (s *KubernetesSearch) getPodFilter(q *logs.SearchParams) podFilter {
+	q.Labels = s.labels.ToCanonical(q.Labels)
+
+	var filter podFilter
+	for key, value := range q.Labels {
+		values := strings.Split(value, ",")
+		switch key {
+		case logs.LabelPod:
+			filter.pods = append(filter.pods, values...)
+		case logs.LabelNode, logs.LabelHost:
+			filter.nodes = append(filter.nodes, values...)
+		case logs.LabelContainer:
+			filter.containers = append(filter.containers, values...)
+		case logs.LabelLevel:
+			// Pods have no such label, lines have it once parsed
+			if filter.lines == nil {
+				filter.lines = make(map[string]string)
+			}
+			filter.lines[key] = value
+		case logs.LabelBackend:
+			// The backend label is matched when the backends of the search are picked
+		default:
+			continue
+		}
+		delete(q.Labels, key)
+	}
+
+	return filter
 }
 
-func podNames(list *v1.PodList) []string {
+func (f podFilter) matchPod(pod v1.Pod) bool {
+	if len(f.pods) > 0 && !collections.MatchItems(pod.Name, f.pods...) {
+		return false
+	}
+
+	return len(f.nodes) == 0 || collections.MatchItems(pod.Spec.NodeName, f.nodes...)
+}
+
+func (f podFilter) matchContainer(name string) bool {
+	return len(f.containers) == 0 || collections.MatchItems(name, f.containers...)
+}
+
+func (f podFilter) matchLine(line logs.Result) bool {
+	return logs.SearchParams{Labels: f.lines}.MatchLabels(line)
+}
+
+func podNames(pods []v1.Pod) []string {
 	var names []string
-	for _, pod := range list.Items {
+	for _, pod := range pods {
 		names = append(names, pod.Name)
 	}
 	return names
 }
 
-func (t *KubernetesSearch) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
-	return t.config.CommonBackend.Routes.MatchRoute(q)
+// Capabilities of Kubernetes. The labels select the pods, or are matched against the parsed lines,
+// and the logs are read from the start of the search, everything else is applied to the lines of the containers.
+func (s *KubernetesSearch) Capabilities() logs.Capabilities {
+	return logs.Capabilities{Labels: true, Parse: true}
+}
+
+// Search returns the logs of the containers of the pods matched by the search.
+func (s *KubernetesSearch) Search(ctx context.Context, q *logs.SearchParams) (r logs.SearchResults, err error) {
+	pods, filter, resultLabels, err := s.findPods(ctx, q)
+	if err != nil {
+		return r, err
+	}
+	if len(pods) == 0 {
+		logger.Debugf("[%s] no pods found", q)
+		return r, nil
+	}
+	logger.Tracef("[%s] searching in pods %s ", q, podNames(pods))
+	r.Results, err = s.getLogResultsForPods(ctx, q, pods, filter, resultLabels)
+	if err != nil {
+		return r, err
+	}
+	r.Total = len(r.Results)
+	return r, nil
+}
+
+// findPods returns the pods matched by the search, the filter of their containers
+// and the labels attached to all of their results.
+func (s *KubernetesSearch) findPods(ctx context.Context, q *logs.SearchParams) (pods []v1.Pod, filter podFilter, resultLabels map[string]string, err error) {
+	selectors, filter, resultLabels, err := s.findPodSelectors(ctx, q)
+	if err != nil {
+		return nil, filter, nil, err
+	}
+
+	for _, selector := range selectors {
+		list, err := s.client.ListPods(ctx, selector)
+		if err != nil {
+			if len(selectors) == 1 {
+				return nil, filter, nil, fmt.Errorf("error fetching the pods for %v: %v", q, err)
+			}
+			logger.Errorf("error fetching pods in namespace %q for %s: %v", selector.Namespace, selector.Options.LabelSelector, err)
+			continue
+		}
+
+		for _, pod := range list.Items {
+			if filter.matchPod(pod) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	return pods, filter, resultLabels, nil
 }
 
-func (s *KubernetesSearch) Search(q *logs.SearchParams) (r logs.SearchResults, err error) {
-	var resultLabels = make(map[string]string)
+// findPodSelectors returns the selectors of the pods matched by the search,
+// the filter of their containers and the labels attached to all of their results.
+func (s *KubernetesSearch) findPodSelectors(ctx context.Context, q *logs.SearchParams) (selectors []PodSelector, filter podFilter, resultLabels map[string]string, err error) {
+	resultLabels = make(map[string]string)
+	filter = s.getPodFilter(q)
 	namespace, name := s.GetNameNamespace(q)
 
 	logger.Debugf("searching %s namespace=%s name=%s", q, namespace, name)
-	var pods *v1.PodList
 	switch {
 	case strings.Contains(strings.ToLower(q.Type), "kubernetespod"):
-		pods, err = s.client.GetPodsWithNameAndLabels(name, namespace, q.Labels)
+		selectors = []PodSelector{PodSelectorForName(name, namespace, q.Labels)}
 
 	case strings.Contains(strings.ToLower(q.Type), "kubernetesnode"):
-		pods, err = s.client.GetAllPodsForNode(q.Id, q.Labels)
+		selectors = []PodSelector{PodSelectorForNode(q.Id, q.Labels)}
 
 	case strings.Contains(strings.ToLower(q.Type), "kubernetesdeployment"):
-		pods, err = s.client.GetPodsForDeployment(name, namespace, q.Labels)
+		selectors, err = s.client.GetPodSelectorsForDeployment(ctx, name, namespace, q.Labels)
 		resultLabels = map[string]string{
 			"deployment": q.Id,
 		}
 	case strings.Contains(strings.ToLower(q.Type), "kubernetesservice"):
-		pods, err = s.client.GetPodsForService(name, namespace, q.Labels)
+		selectors, err = s.client.GetPodSelectorsForService(ctx, name, namespace, q.Labels)
 		resultLabels = map[string]string{
 			"service": q.Id,
 		}
 	}
 
 	if err != nil {
-		return r, fmt.Errorf("error fetching the pods for node %v: %v", q, err)
+		return nil, filter, nil, fmt.Errorf("error fetching the pods for %v: %v", q, err)
 	}
-	if pods == nil || len(pods.Items) == 0 {
-		logger.Debugf("[%s] no pods found", q)
-		return r, nil
+
+	resultLabels = collections.MergeMap(collections.MergeMap(map[string]string{}, s.config.CommonBackend.Labels), resultLabels)
+	return selectors, filter, resultLabels, nil
+}
+
+// podLabels returns the labels of the results of a container of the pod.
+func (s *KubernetesSearch) podLabels(pod v1.Pod, containerName string, resultLabels map[string]string) map[string]string {
+	var labels = s.labels.ToCanonical(map[string]string{
+		"pod":           pod.Name,
+		"containerName": containerName,
+		"nodeName":      pod.Spec.NodeName,
+		"namespace":     pod.Namespace,
+	})
+	for k, v := range resultLabels {
+		labels[k] = v
 	}
-	logger.Tracef("[%s] searching in pods %s ", q, podNames(pods))
-	r.Results = s.getLogResultsForPods(q, pods, collections.MergeMap(s.config.CommonBackend.Labels, resultLabels))
-	r.Total = len(r.Results)
-	return r, nil
+
+	return labels
 }
 
-func (s *KubernetesSearch) getLogResultsForPods(q *logs.SearchParams, pods *v1.PodList, resultLabels map[string]string) []logs.Result {
+func (s *KubernetesSearch) getLogResultsForPods(ctx context.Context, q *logs.SearchParams, pods []v1.Pod, filter podFilter, resultLabels map[string]string) ([]logs.Result, error) {
 	var results []logs.Result
-	for _, pod := range pods.Items {
-		podLogs, err := s.client.GetLogsForPod(q, pod)
+	for _, pod := range pods {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		podLogs, err := s.client.GetLogsForPod(ctx, q, pod, filter.matchContainer)
 		if err != nil {
 			logger.Errorf("error fetching logs for pod: %v in namespace: %v, err: ", pod.Name, pod.Namespace, err)
 			continue
 		}
 		for containerName, containerLogs := range podLogs {
-			var labels = map[string]string{
-				"pod":           pod.Name,
-				"containerName": containerName,
-				"nodeName":      pod.Spec.NodeName,
-				"namespace":     pod.Namespace,
-			}
-			for k, v := range resultLabels {
-				labels[k] = v
-			}
-			for _, line := range containerLogs {
-				line.Labels = labels
-				line = line.Process()
-				if line.Message != "" {
+			var labels = s.podLabels(pod, containerName, resultLabels)
+			// Lines are grouped before they're processed, which trims their indentation
+			for _, event := range s.multiline.Group(containerLogs) {
+				if line, ok := s.event(event, labels); ok && filter.matchLine(line) {
 					results = append(results, line)
 				}
 			}
 		}
 	}
-	return results
+	return results, nil
+}
+
+// event returns the result of the event of a container, with its continuation lines folded into it,
+// and whether it has a message. The blank lines of an event are kept, only blank events are dropped.
+func (s *KubernetesSearch) event(event logs.Result, labels map[string]string) (logs.Result, bool) {
+	if strings.TrimSpace(event.Message) == "" {
+		return event, false
+	}
+
+	event.Labels = labels
+	event = s.parse(event.Process())
+	return event, event.Message != ""
+}
+
+// parse parses the message of the line with the parse config of the backend, if any.
+func (s *KubernetesSearch) parse(line logs.Result) logs.Result {
+	if s.config.Parse == nil {
+		return line
+	}
+	return s.config.Parse.Parse(line)
 }
 
 func (s *KubernetesSearch) GetNameNamespace(q *logs.SearchParams) (namespace, name string) {
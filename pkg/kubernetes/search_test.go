@@ -0,0 +1,35 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestGetPodFilter(t *testing.T) {
+	s := &KubernetesSearch{config: &logs.KubernetesSearchBackendConfig{}}
+	q := &logs.SearchParams{Labels: map[string]string{
+		logs.LabelPod:   "api-*",
+		logs.LabelLevel: "error,warn",
+		"app":           "api",
+	}}
+
+	filter := s.getPodFilter(q)
+	if want := map[string]string{"app": "api"}; !reflect.DeepEqual(q.Labels, want) {
+		t.Errorf("getPodFilter() left labels %v, want %v", q.Labels, want)
+	}
+	if want := []string{"api-*"}; !reflect.DeepEqual(filter.pods, want) {
+		t.Errorf("getPodFilter() pods = %v, want %v", filter.pods, want)
+	}
+
+	for level, want := range map[string]bool{"error": true, "warn": true, "info": false, "": false} {
+		line := logs.Result{Labels: map[string]string{logs.LabelPod: "api-1"}}
+		if level != "" {
+			line.Labels[logs.LabelLevel] = level
+		}
+		if got := filter.matchLine(line); got != want {
+			t.Errorf("matchLine() of level %q = %v, want %v", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/flanksource/commons/logger"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// watchRetryInterval is how long to wait before watching the pods again
+// after a watch failed.
+var watchRetryInterval = 5 * time.Second
+
+// multilineFlushInterval is how long the last line of a followed container is held,
+// for the lines that may continue its multiline event, before it is sent.
+var multilineFlushInterval = time.Second
+
+// Tail follows the logs of every container of the pods matched by the search.
+//
+// The pods are watched, so the containers of the pods scheduled after the tail started
+// are followed from their start and the pods that are deleted stop being followed.
+// Restarted containers are followed again from their new start.
+func (s *KubernetesSearch) Tail(ctx context.Context, q *logs.SearchParams, results chan<- logs.Result) error {
+	node, err := query.Parse(q.Query)
+	if err != nil {
+		return err
+	}
+
+	selectors, filter, resultLabels, err := s.findPodSelectors(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	f := &podFollower{
+		search:       s,
+		q:            q,
+		filter:       filter,
+		node:         node,
+		resultLabels: resultLabels,
+		results:      results,
+		started:      time.Now(),
+		pods:         make(map[string]*followedPod),
+	}
+	defer f.wg.Wait()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(selectors))
+	for i, selector := range selectors {
+		wg.Add(1)
+		go func(i int, selector PodSelector) {
+			defer wg.Done()
+			errs[i] = f.watch(ctx, selector)
+		}(i, selector)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// followedPod holds the containers of a pod being followed.
+type followedPod struct {
+	cancel context.CancelFunc
+	ctx    context.Context
+
+	// containers holds the containers that are, or were, followed
+	// keyed by their name and start time
+	containers map[string]bool
+}
+
+// podFollower follows the containers of the pods of a tail as they start.
+type podFollower struct {
+	search       *KubernetesSearch
+	q            *logs.SearchParams
+	filter       podFilter
+	node         query.Node
+	resultLabels map[string]string
+	results      chan<- logs.Result
+
+	// started is when the tail started. Containers that started later
+	// are followed from their start rather than from the start of the search.
+	started time.Time
+
+	mu   sync.Mutex
+	pods map[string]*followedPod
+	wg   sync.WaitGroup
+}
+
+// watch follows the pods of the selector until the context is done.
+// The watch is started again whenever the API server closes it.
+func (f *podFollower) watch(ctx context.Context, selector PodSelector) error {
+	for {
+		w, err := f.search.client.WatchPods(ctx, selector)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error watching pods in namespace %q: %w", selector.Namespace, err)
+		}
+
+		f.handleEvents(ctx, w)
+		w.Stop()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchRetryInterval):
+		}
+		logger.Debugf("watching pods in namespace %q with %q again", selector.Namespace, selector.Options.LabelSelector)
+	}
+}
+
+func (f *podFollower) handleEvents(ctx context.Context, w watch.Interface) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+
+			pod, ok := event.Object.(*v1.Pod)
+			if !ok {
+				// An error event, the watch is about to be closed
+				logger.Debugf("unexpected pod watch event %s: %v", event.Type, event.Object)
+				continue
+			}
+
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if f.filter.matchPod(*pod) {
+					f.attach(ctx, *pod)
+				}
+			case watch.Deleted:
+				f.detach(*pod)
+			}
+		}
+	}
+}
+
+// attach follows the running containers of the pod that are not followed yet.
+func (f *podFollower) attach(ctx context.Context, pod v1.Pod) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	followed, ok := f.pods[string(pod.UID)]
+	if !ok {
+		podCtx, cancel := context.WithCancel(ctx)
+		followed = &followedPod{ctx: podCtx, cancel: cancel, containers: make(map[string]bool)}
+		f.pods[string(pod.UID)] = followed
+	}
+
+	for _, status := range append(pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses...) {
+		if status.State.Running == nil || !f.filter.matchContainer(status.Name) {
+			continue
+		}
+
+		startedAt := status.State.Running.StartedAt.Time
+		key := status.Name + "@" + startedAt.String()
+		if followed.containers[key] {
+			continue
+		}
+		followed.containers[key] = true
+
+		q := f.q.Clone()
+		if startedAt.After(f.started) {
+			q.SetStart(startedAt)
+		}
+
+		logger.Debugf("following %s/%s/%s", pod.Namespace, pod.Name, status.Name)
+		f.wg.Add(1)
+		go func(container string) {
+			defer f.wg.Done()
+			if err := f.search.followContainer(followed.ctx, q, pod, container, f.filter, f.resultLabels, f.node, f.results); err != nil {
+				logger.Warnf("error following %s/%s/%s: %v", pod.Namespace, pod.Name, container, err)
+			}
+		}(status.Name)
+	}
+}
+
+// detach stops following the containers of the deleted pod.
+func (f *podFollower) detach(pod v1.Pod) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if followed, ok := f.pods[string(pod.UID)]; ok {
+		logger.Debugf("pod %s/%s was deleted. no longer following it", pod.Namespace, pod.Name)
+		followed.cancel()
+		delete(f.pods, string(pod.UID))
+	}
+}
+
+// followContainer sends the lines of a container that match the query, and the labels of the lines
+// of the filter, as they are written until the container stops or the context is done.
+func (s *KubernetesSearch) followContainer(ctx context.Context, q *logs.SearchParams, pod v1.Pod, container string, filter podFilter, resultLabels map[string]string, node query.Node, results chan<- logs.Result) error {
+	stream, err := s.client.StreamLogsForContainer(ctx, q, pod, container)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer stream.Close()
+
+	labels := s.podLabels(pod, container, resultLabels)
+	err = s.foldLines(ctx, stream, func(event logs.Result) bool {
+		line, ok := s.event(event, labels)
+		if !ok || !filter.matchLine(line) || !query.Matches(node, line) {
+			return true
+		}
+
+		select {
+		case results <- line:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// foldLines reads the lines of the stream, folds the continuation lines of multiline events
+// into the line before them, and sends every event until the stream ends or send returns false.
+//
+// An event is held until the line after it, as it may continue the event, or until no line
+// was written for multilineFlushInterval.
+func (s *KubernetesSearch) foldLines(ctx context.Context, stream io.Reader, send func(logs.Result) bool) error {
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	var pending *logs.Result
+	var folded int
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-flush:
+			flush = nil
+			if !send(*pending) {
+				return nil
+			}
+			pending = nil
+
+		case text, ok := <-lines:
+			if !ok {
+				if pending != nil && !send(*pending) {
+					return nil
+				}
+				if ctx.Err() != nil {
+					return nil
+				}
+				return <-scanErr
+			}
+
+			line := getLogResult(text)
+			if pending != nil && folded < s.multiline.MaxLines() && s.multiline.Continues(line.Message) {
+				pending.Message = s.multiline.Append(pending.Message, line.Message)
+				folded++
+				flush = time.After(multilineFlushInterval)
+				continue
+			}
+
+			if pending != nil && !send(*pending) {
+				return nil
+			}
+			pending, flush = nil, nil
+			if s.multiline == nil {
+				if !send(line) {
+					return nil
+				}
+				continue
+			}
+			pending, folded = &line, 1
+			flush = time.After(multilineFlushInterval)
+		}
+	}
+}
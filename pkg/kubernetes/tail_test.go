@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestFoldLines(t *testing.T) {
+	multiline, err := (&logs.MultilineConfig{Detectors: []string{logs.MultilinePython}}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &KubernetesSearch{config: &logs.KubernetesSearchBackendConfig{}, multiline: multiline}
+
+	stream := strings.Join([]string{
+		"2023-03-09T12:00:00Z ",
+		"2023-03-09T12:00:01Z request failed",
+		"2023-03-09T12:00:02Z Traceback (most recent call last):",
+		`2023-03-09T12:00:02Z   File "app.py", line 3, in <module>`,
+		"2023-03-09T12:00:02Z ",
+		"2023-03-09T12:00:02Z KeyError: 'id'",
+		"2023-03-09T12:00:03Z stopped",
+	}, "\n")
+
+	var got []string
+	err = s.foldLines(context.Background(), strings.NewReader(stream), func(event logs.Result) bool {
+		if line, ok := s.event(event, nil); ok {
+			got = append(got, line.Message)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("foldLines() error = %v", err)
+	}
+
+	// The blank line without an event before it is dropped, the blank line of the traceback is kept
+	want := []string{
+		"request failed\nTraceback (most recent call last):\n  File \"app.py\", line 3, in <module>\n\nKeyError: 'id'",
+		"stopped",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("foldLines() = %q, want %q", got, want)
+	}
+}
+
+func TestFoldLinesFlush(t *testing.T) {
+	interval := multilineFlushInterval
+	multilineFlushInterval = 10 * time.Millisecond
+	defer func() { multilineFlushInterval = interval }()
+
+	multiline, err := (&logs.MultilineConfig{Detectors: []string{logs.MultilineJava}}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &KubernetesSearch{config: &logs.KubernetesSearchBackendConfig{}, multiline: multiline}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The stream stays open, so the last event is only sent once it's held for long enough
+	r, w := io.Pipe()
+	defer w.Close()
+	events := make(chan string)
+	go s.foldLines(ctx, r, func(event logs.Result) bool {
+		events <- event.Message
+		return true
+	})
+
+	if _, err := io.WriteString(w, "2023-03-09T12:00:00Z closed\n2023-03-09T12:00:00Z \tat com.acme.Api.get(Api.java:12)\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-events:
+		if want := "closed\n\tat com.acme.Api.get(Api.java:12)"; got != want {
+			t.Errorf("foldLines() = %q, want %q", got, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("foldLines() didn't flush the last event")
+	}
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/logger"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// LabelsCacheTTL is how long the labels discovered on a backend are cached.
+var LabelsCacheTTL = 5 * time.Minute
+
+// labelsCache holds the labels discovered on the backends keyed by the backend and the label.
+var labelsCache = cache.New(LabelsCacheTTL, 10*time.Minute)
+
+// Labels lists the keys of the labels of the backends, given by the backend query parameter,
+// or of every backend.
+func Labels(c echo.Context) error {
+	cc := c.(*api.Context)
+	labels, err := DiscoverLabels(c.Request().Context(), logs.GlobalBackends, c.QueryParams()["backend"], "")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return cc.JSON(http.StatusOK, labels)
+}
+
+// LabelValues lists the values seen for a label on the backends, given by the backend query parameter,
+// or on every backend.
+func LabelValues(c echo.Context) error {
+	cc := c.(*api.Context)
+	label := c.Param("label")
+	if label == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "label is required")
+	}
+
+	labels, err := DiscoverLabels(c.Request().Context(), logs.GlobalBackends, c.QueryParams()["backend"], label)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return cc.JSON(http.StatusOK, labels)
+}
+
+// DiscoverLabels lists the label keys of the backends with the given names, or the values of the label when set,
+// concurrently and merges them. Every backend is listed when no names are given.
+//
+// What is discovered on a backend is cached for LabelsCacheTTL.
+func DiscoverLabels(ctx context.Context, backends []logs.SearchBackend, names []string, label string) (*logs.DiscoveredLabels, error) {
+	var selected []logs.SearchBackend
+	if len(names) == 0 {
+		selected = backends
+	}
+	for _, name := range names {
+		backend := findBackend(backends, name)
+		if backend == nil {
+			return nil, fmt.Errorf("backend %q not found", name)
+		}
+		selected = append(selected, *backend)
+	}
+
+	discovered := &logs.DiscoveredLabels{
+		Label:    label,
+		Values:   []string{},
+		Backends: make([]logs.BackendLabels, len(selected)),
+	}
+
+	var wg sync.WaitGroup
+	for i, backend := range selected {
+		wg.Add(1)
+		go func(i int, backend logs.SearchBackend) {
+			defer wg.Done()
+			discovered.Backends[i] = logs.BackendLabels{Backend: backend.Name, Type: backend.Type}
+			values, err := discoverBackendLabels(ctx, backend, label)
+			if err != nil {
+				logger.Errorf("error discovering labels of backend[%s]: %v", backend.Name, err)
+				discovered.Backends[i].Error = err.Error()
+				return
+			}
+			discovered.Backends[i].Values = values
+		}(i, backend)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, b := range discovered.Backends {
+		for _, v := range b.Values {
+			if !seen[v] {
+				seen[v] = true
+				discovered.Values = append(discovered.Values, v)
+			}
+		}
+	}
+	sort.Strings(discovered.Values)
+
+	return discovered, nil
+}
+
+// discoverBackendLabels returns the label keys of the backend, or the values of the label when set,
+// from the cache or from the backend.
+func discoverBackendLabels(ctx context.Context, backend logs.SearchBackend, label string) ([]string, error) {
+	discoverer, ok := backend.API.(logs.LabelDiscoverer)
+	if !ok {
+		return nil, fmt.Errorf("backend doesn't support label discovery")
+	}
+
+	key := backend.Name + "/" + label
+	if values, ok := labelsCache.Get(key); ok {
+		return values.([]string), nil
+	}
+
+	timeout := backend.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBackendTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var values []string
+	var err error
+	if label == "" {
+		values, err = discoverer.LabelKeys(ctx)
+	} else {
+		values, err = discoverer.LabelValues(ctx, label)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		return nil, err
+	}
+
+	labelsCache.Set(key, values, LabelsCacheTTL)
+	return values, nil
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// discoveringSearch is a backend with static labels that counts the discoveries made on it.
+type discoveringSearch struct {
+	staticSearch
+	labels      map[string][]string
+	discoveries int
+}
+
+func (t *discoveringSearch) LabelKeys(ctx context.Context) ([]string, error) {
+	t.discoveries++
+	var keys []string
+	for k := range t.labels {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (t *discoveringSearch) LabelValues(ctx context.Context, label string) ([]string, error) {
+	t.discoveries++
+	return t.labels[label], nil
+}
+
+func TestDiscoverLabels(t *testing.T) {
+	files := &discoveringSearch{labels: map[string][]string{"path": {"/var/log/app.log"}, "level": {"info"}}}
+	pods := &discoveringSearch{labels: map[string][]string{"pod": {"api", "web"}, "level": {"error", "info"}}}
+	backends := []logs.SearchBackend{
+		{Name: "labels-files", Type: logs.BackendTypeFile, API: files},
+		{Name: "labels-pods", Type: logs.BackendTypeKubernetes, API: pods},
+		{Name: "labels-static", Type: logs.BackendTypeFile, API: staticSearch{}},
+	}
+
+	got, err := DiscoverLabels(context.Background(), backends, nil, "level")
+	if err != nil {
+		t.Fatalf("DiscoverLabels() error = %v", err)
+	}
+	if want := []string{"error", "info"}; !reflect.DeepEqual(got.Values, want) {
+		t.Errorf("DiscoverLabels() = %v, want %v", got.Values, want)
+	}
+	if got.Backends[2].Error == "" {
+		t.Errorf("DiscoverLabels() expected an error for a backend without label discovery")
+	}
+
+	got, err = DiscoverLabels(context.Background(), backends, []string{"labels-pods"}, "level")
+	if err != nil {
+		t.Fatalf("DiscoverLabels() error = %v", err)
+	}
+	if want := []string{"error", "info"}; !reflect.DeepEqual(got.Values, want) || len(got.Backends) != 1 {
+		t.Errorf("DiscoverLabels() = %v, want %v from a single backend", got.Values, want)
+	}
+	if pods.discoveries != 1 {
+		t.Errorf("DiscoverLabels() discovered the values %d times, want them cached after the first time", pods.discoveries)
+	}
+
+	got, err = DiscoverLabels(context.Background(), backends, []string{"labels-files", "labels-pods"}, "")
+	if err != nil {
+		t.Fatalf("DiscoverLabels() error = %v", err)
+	}
+	if want := []string{"level", "path", "pod"}; !reflect.DeepEqual(got.Values, want) {
+		t.Errorf("DiscoverLabels() = %v, want %v", got.Values, want)
+	}
+
+	if _, err := DiscoverLabels(context.Background(), backends, []string{"missing"}, ""); err == nil {
+		t.Errorf("DiscoverLabels() expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+)
+
+// prepareSearch returns the search sent to a backend with the given capabilities
+// and the offset of the page requested from a backend that doesn't paginate.
+// Searches are run and explained with it, so the explained search is the one sent.
+//
+// The backend label is removed from the search and, as the page token of a backend
+// that doesn't paginate is the offset of the page in its results,
+// a backend that applies the limit is asked for every result up to the end of the page.
+func prepareSearch(q *logs.SearchParams, caps logs.Capabilities) (*logs.SearchParams, int, error) {
+	q = withoutBackendLabel(q)
+	if caps.Page {
+		return q, 0, nil
+	}
+
+	var offset int
+	if q.Page != "" {
+		var err error
+		if offset, err = strconv.Atoi(q.Page); err != nil || offset < 0 {
+			return nil, 0, fmt.Errorf("invalid page token %q", q.Page)
+		}
+	}
+
+	backendParams := q.Clone()
+	backendParams.Page = ""
+	if caps.Limit && q.Limit > 0 {
+		backendParams.Limit = int64(offset) + q.Limit
+	}
+
+	return backendParams, offset, nil
+}
+
+// postFilter applies the parts of the search the backend didn't apply itself to its results.
+//
+// Results are dropped when they are outside the time window of the search, don't match its query
+// or don't have its labels, and the facets are counted over the remaining results.
+// The results of a backend that doesn't paginate are then sorted and the requested page
+// is cut out of them, each result carrying the offset that follows it as its cursor.
+func postFilter(q *logs.SearchParams, caps logs.Capabilities, offset int, results logs.SearchResults) (logs.SearchResults, error) {
+	if caps.All() {
+		return results, nil
+	}
+
+	var node query.Node
+	if !caps.Query {
+		var err error
+		if node, err = query.Parse(q.Query); err != nil {
+			return results, err
+		}
+	}
+
+	filtered := make([]logs.Result, 0, len(results.Results))
+	for _, r := range results.Results {
+		if !caps.TimeRange && !q.InTimeRange(r) {
+			continue
+		}
+		if !caps.Query && !query.Matches(node, r) {
+			continue
+		}
+		if !caps.Labels && !q.MatchLabels(r) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	results.Results = filtered
+
+	if !caps.Limit {
+		results.Total = len(filtered)
+	}
+	if !caps.Facets && len(q.Facets) > 0 {
+		results.Facets = logs.CountFacets(q.Facets, q.GetFacetLimit(), filtered)
+	}
+	if caps.Page {
+		return results, nil
+	}
+
+	// The limited results of a backend may have been cut short before the end of its results
+	truncated := caps.Limit && q.Limit > 0 && int64(len(filtered)) >= int64(offset)+q.Limit
+
+	sorted := logs.MergeResults(q.Sort, 0, 0, filtered).Results
+	if offset > len(sorted) {
+		offset = len(sorted)
+	}
+	page := logs.MergeResults(q.Sort, q.Limit, q.LimitBytes, sorted[offset:]).Results
+	for i := range page {
+		page[i].Cursor = strconv.Itoa(offset + i + 1)
+	}
+
+	results.Results = page
+	results.NextPage = ""
+	if end := offset + len(page); len(page) > 0 && (end < len(sorted) || truncated) {
+		results.NextPage = strconv.Itoa(end)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestPostFilter(t *testing.T) {
+	results := logs.SearchResults{Results: []logs.Result{
+		{Time: "2023-03-09T10:00:00Z", Message: "starting", Labels: map[string]string{"pod": "api"}},
+		{Time: "2023-03-09T12:00:00Z", Message: "error: timeout", Labels: map[string]string{"pod": "api"}},
+		{Time: "2023-03-09T11:00:00Z", Message: "error: refused", Labels: map[string]string{"pod": "web"}},
+		{Time: "2023-03-09T13:00:00Z", Message: "error: refused", Labels: map[string]string{"pod": "api"}},
+		{Time: "2023-03-09T09:00:00Z", Message: "error: too early", Labels: map[string]string{"pod": "api"}},
+	}}
+
+	tests := []struct {
+		name         string
+		q            logs.SearchParams
+		caps         logs.Capabilities
+		wantMessages []string
+		wantTotal    int
+		wantNextPage string
+	}{
+		{
+			name:         "filters and sorts",
+			q:            logs.SearchParams{Start: "2023-03-09T09:30:00Z", Query: "error", Labels: map[string]string{"pod": "api"}, Limit: 10, Sort: logs.SortDescending},
+			wantMessages: []string{"error: refused", "error: timeout"},
+			wantTotal:    2,
+		},
+		{
+			name:         "first page",
+			q:            logs.SearchParams{Query: "error", Limit: 2, Sort: logs.SortAscending},
+			wantMessages: []string{"error: too early", "error: refused"},
+			wantTotal:    4,
+			wantNextPage: "2",
+		},
+		{
+			name:         "last page",
+			q:            logs.SearchParams{Query: "error", Limit: 2, Sort: logs.SortAscending, Page: "2"},
+			wantMessages: []string{"error: timeout", "error: refused"},
+			wantTotal:    4,
+		},
+		{
+			name:         "labels with multiple values",
+			q:            logs.SearchParams{Labels: map[string]string{"pod": "web,db"}, Limit: 10},
+			wantMessages: []string{"error: refused"},
+			wantTotal:    1,
+		},
+		{
+			name:         "query applied by the backend",
+			q:            logs.SearchParams{Query: "missing", Labels: map[string]string{"pod": "web"}, Limit: 10},
+			caps:         logs.Capabilities{Query: true},
+			wantMessages: []string{"error: refused"},
+			wantTotal:    1,
+		},
+		{
+			name:         "limited backend may have more results",
+			q:            logs.SearchParams{Limit: 2, Sort: logs.SortDescending, Page: "3"},
+			caps:         logs.Capabilities{TimeRange: true, Query: true, Labels: true, Limit: true},
+			wantMessages: []string{"starting", "error: too early"},
+			wantNextPage: "5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backendParams, offset, err := prepareSearch(&tt.q, tt.caps)
+			if err != nil {
+				t.Fatalf("prepareSearch() error = %v", err)
+			}
+			if backendParams.Page != "" {
+				t.Errorf("prepareSearch() page = %q, want none", backendParams.Page)
+			}
+
+			got, err := postFilter(&tt.q, tt.caps, offset, results)
+			if err != nil {
+				t.Fatalf("postFilter() error = %v", err)
+			}
+
+			var messages []string
+			for _, r := range got.Results {
+				messages = append(messages, r.Message)
+			}
+			if !reflect.DeepEqual(messages, tt.wantMessages) {
+				t.Errorf("postFilter() = %v, want %v", messages, tt.wantMessages)
+			}
+			if got.Total != tt.wantTotal {
+				t.Errorf("postFilter() total = %d, want %d", got.Total, tt.wantTotal)
+			}
+			if got.NextPage != tt.wantNextPage {
+				t.Errorf("postFilter() next page = %q, want %q", got.NextPage, tt.wantNextPage)
+			}
+		})
+	}
+}
+
+func TestPrepareSearch(t *testing.T) {
+	q := &logs.SearchParams{Limit: 20, Page: "40"}
+
+	got, offset, err := prepareSearch(q, logs.Capabilities{Limit: true})
+	if err != nil {
+		t.Fatalf("prepareSearch() error = %v", err)
+	}
+	if offset != 40 || got.Limit != 60 || got.Page != "" {
+		t.Errorf("prepareSearch() = limit %d, page %q, offset %d, want limit 60, no page, offset 40", got.Limit, got.Page, offset)
+	}
+
+	if got, _, _ := prepareSearch(q, logs.Capabilities{Limit: true, Page: true}); got != q {
+		t.Errorf("prepareSearch() changed the search of a paginated backend")
+	}
+
+	if _, _, err := prepareSearch(&logs.SearchParams{Page: "abc"}, logs.Capabilities{}); err == nil {
+		t.Errorf("prepareSearch() expected an error for an invalid page token")
+	}
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// ToCloudWatch translates the query to the condition of a CloudWatch Logs Insights filter command.
+// The labels of the query are translated to fields with the label mapping.
+func ToCloudWatch(node Node, mapping logs.LabelMapping) string {
+	switch n := node.(type) {
+	case And:
+		return "(" + toCloudWatchNodes(n.Nodes, " and ", mapping) + ")"
+
+	case Or:
+		return "(" + toCloudWatchNodes(n.Nodes, " or ", mapping) + ")"
+
+	case Not:
+		return "not " + ToCloudWatch(n.Node, mapping)
+
+	case Match:
+		field := cloudWatchField(n, mapping)
+		switch n.Op {
+		case OpMatch:
+			if n.IsMessage() {
+				return field + " like /(?i)" + escapeCloudWatchRegex(regexp.QuoteMeta(n.Value)) + "/"
+			}
+			return field + " = " + strconv.Quote(n.Value)
+		case OpWildcard:
+			return field + " like /" + escapeCloudWatchRegex(wildcardRegex(n.Value, !n.IsMessage())) + "/"
+		case OpRegex:
+			return field + " like /" + escapeCloudWatchRegex(n.Value) + "/"
+		case OpGT, OpGTE, OpLT, OpLTE:
+			return field + " " + strings.TrimPrefix(string(n.Op), ":") + " " + cloudWatchValue(n.Value)
+		}
+	}
+
+	return "1 = 1"
+}
+
+func toCloudWatchNodes(nodes []Node, sep string, mapping logs.LabelMapping) string {
+	conditions := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		conditions = append(conditions, ToCloudWatch(n, mapping))
+	}
+	return strings.Join(conditions, sep)
+}
+
+func cloudWatchField(m Match, mapping logs.LabelMapping) string {
+	switch {
+	case m.IsMessage():
+		return "@message"
+	case m.Field == FieldTime:
+		return "@timestamp"
+	case m.Field == FieldId:
+		return "@ptr"
+	}
+
+	return "`" + mapping.Native(m.Field) + "`"
+}
+
+// cloudWatchValue returns numbers as they are and quotes everything else.
+func cloudWatchValue(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+func escapeCloudWatchRegex(expr string) string {
+	return strings.ReplaceAll(expr, "/", `\/`)
+}
@@ -0,0 +1,131 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// ElasticsearchFields are the fields of an Elasticsearch or OpenSearch index
+// the fields of a query are translated to.
+type ElasticsearchFields struct {
+	Message   string
+	Timestamp string
+	Labels    logs.LabelMapping
+}
+
+func (t ElasticsearchFields) field(m Match) string {
+	switch {
+	case m.IsMessage():
+		return t.Message
+	case m.Field == FieldTime:
+		return t.Timestamp
+	case m.Field == FieldId:
+		return "_id"
+	}
+
+	return t.Labels.Native(m.Field)
+}
+
+// ToElasticsearch translates the query to the bool query DSL of Elasticsearch and OpenSearch.
+func ToElasticsearch(node Node, fields ElasticsearchFields) map[string]any {
+	switch n := node.(type) {
+	case And:
+		return map[string]any{"bool": map[string]any{"filter": toElasticsearchNodes(n.Nodes, fields)}}
+
+	case Or:
+		return map[string]any{"bool": map[string]any{
+			"should":               toElasticsearchNodes(n.Nodes, fields),
+			"minimum_should_match": 1,
+		}}
+
+	case Not:
+		return map[string]any{"bool": map[string]any{"must_not": []any{ToElasticsearch(n.Node, fields)}}}
+
+	case Match:
+		field := fields.field(n)
+		switch n.Op {
+		case OpMatch:
+			return map[string]any{"match_phrase": map[string]any{field: n.Value}}
+		case OpWildcard:
+			return map[string]any{"wildcard": map[string]any{field: map[string]any{"value": n.Value, "case_insensitive": true}}}
+		case OpRegex:
+			// Elasticsearch anchors regular expressions to the whole term
+			return map[string]any{"regexp": map[string]any{field: map[string]any{"value": ".*" + n.Value + ".*"}}}
+		case OpGT, OpGTE, OpLT, OpLTE:
+			return map[string]any{"range": map[string]any{field: map[string]any{rangeOperators[n.Op]: n.Value}}}
+		}
+	}
+
+	return map[string]any{"match_all": map[string]any{}}
+}
+
+var rangeOperators = map[Op]string{
+	OpGT:  "gt",
+	OpGTE: "gte",
+	OpLT:  "lt",
+	OpLTE: "lte",
+}
+
+func toElasticsearchNodes(nodes []Node, fields ElasticsearchFields) []any {
+	clauses := make([]any, 0, len(nodes))
+	for _, n := range nodes {
+		clauses = append(clauses, ToElasticsearch(n, fields))
+	}
+	return clauses
+}
+
+// ElasticsearchTemplate is the data the query templates of Elasticsearch and OpenSearch are rendered with.
+// QueryDSL holds the query of the search translated to JSON, for templates that place it themselves,
+// and NativeLabels the labels of the search keyed by the fields of the index.
+type ElasticsearchTemplate struct {
+	*logs.SearchParams
+	QueryDSL     string
+	NativeLabels map[string]string
+}
+
+// NewElasticsearchTemplate parses the query of the search
+// and returns the data to render a query template with.
+func NewElasticsearchTemplate(q *logs.SearchParams, fields ElasticsearchFields) (*ElasticsearchTemplate, error) {
+	data := &ElasticsearchTemplate{SearchParams: q, QueryDSL: "{}", NativeLabels: fields.Labels.ToNative(q.Labels)}
+
+	node, err := Parse(q.Query)
+	if err != nil || node == nil {
+		return data, err
+	}
+
+	dsl, err := json.Marshal(ToElasticsearch(node, fields))
+	if err != nil {
+		return nil, err
+	}
+	data.QueryDSL = string(dsl)
+	return data, nil
+}
+
+// AddToElasticsearchBody adds the query DSL as a filter to the query of a rendered search body.
+func AddToElasticsearchBody(body string, dsl string) (string, error) {
+	var search map[string]any
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	// Keeps the precision of large numbers, e.g. in search_after
+	decoder.UseNumber()
+	if err := decoder.Decode(&search); err != nil {
+		return "", fmt.Errorf("error parsing the rendered query: %w", err)
+	}
+	if search == nil {
+		search = make(map[string]any)
+	}
+
+	filter := []any{json.RawMessage(dsl)}
+	if existing, ok := search["query"]; ok {
+		filter = append([]any{existing}, filter...)
+	}
+	search["query"] = map[string]any{"bool": map[string]any{"filter": filter}}
+
+	out, err := json.Marshal(search)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,151 @@
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// Matches evaluates the query against the result.
+// A nil node matches every result.
+//
+// Messages are matched without regard to case
+// and labels are equal when they are equal without regard to case.
+func Matches(node Node, r logs.Result) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+
+	case And:
+		for _, child := range n.Nodes {
+			if !Matches(child, r) {
+				return false
+			}
+		}
+		return true
+
+	case Or:
+		for _, child := range n.Nodes {
+			if Matches(child, r) {
+				return true
+			}
+		}
+		return false
+
+	case Not:
+		return !Matches(n.Node, r)
+
+	case Match:
+		value, ok := fieldValue(n, r)
+		if !ok {
+			return false
+		}
+		return n.matchValue(value)
+	}
+
+	return false
+}
+
+// Filter returns the results that match the query.
+func Filter(node Node, results []logs.Result) []logs.Result {
+	if node == nil {
+		return results
+	}
+
+	filtered := results[:0]
+	for _, r := range results {
+		if Matches(node, r) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+func fieldValue(m Match, r logs.Result) (string, bool) {
+	switch {
+	case m.IsMessage():
+		return r.Message, true
+	case m.Field == FieldTime:
+		return r.Time, r.Time != ""
+	case m.Field == FieldId:
+		return r.Id, r.Id != ""
+	}
+
+	value, ok := r.Labels[m.Field]
+	return value, ok
+}
+
+func (t Match) matchValue(value string) bool {
+	switch t.Op {
+	case OpMatch:
+		if t.IsMessage() {
+			return strings.Contains(strings.ToLower(value), strings.ToLower(t.Value))
+		}
+		return strings.EqualFold(value, t.Value)
+
+	case OpWildcard:
+		return t.matchRegex(wildcardRegex(t.Value, !t.IsMessage()), value)
+
+	case OpRegex:
+		return t.matchRegex(t.Value, value)
+
+	case OpGT:
+		return compare(value, t.Value) > 0
+	case OpGTE:
+		return compare(value, t.Value) >= 0
+	case OpLT:
+		return compare(value, t.Value) < 0
+	case OpLTE:
+		return compare(value, t.Value) <= 0
+	}
+
+	return false
+}
+
+// wildcardRegex converts a value with * wildcards to a case insensitive regular expression.
+// An anchored expression matches the whole value rather than a part of it.
+func wildcardRegex(value string, anchored bool) string {
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(value), `\*`, ".*")
+	if anchored {
+		pattern = "^" + pattern + "$"
+	}
+	return "(?i)" + pattern
+}
+
+func (t Match) matchRegex(expr, value string) bool {
+	if t.re != nil {
+		return t.re.MatchString(value)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(value)
+}
+
+// compare compares the values as numbers, times or strings
+// in that order of preference.
+func compare(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if x, ok := logs.ParseTimestamp(a); ok {
+		if y, ok := logs.ParseTimestamp(b); ok {
+			return x.Compare(y)
+		}
+	}
+
+	return strings.Compare(a, b)
+}
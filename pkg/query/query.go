@@ -0,0 +1,414 @@
+// Package query implements the generic query language of a search
+// and its translation to the query languages of the backends.
+//
+// A query is made of terms combined with AND, OR and NOT (or a leading -).
+// Terms next to each other are combined with AND and parentheses group terms.
+//
+//	error                      the message contains "error"
+//	"connection refused"       the message contains the phrase
+//	/timed? out/               the message matches the regular expression
+//	pod:nginx-*                the label matches the value, * matches anything
+//	level:/warn|error/         the label matches the regular expression
+//	status:>=500               the label compares to the value, also :>, :< and :<=
+//	pod:nginx AND NOT level:debug OR (namespace:kube-system -level:info)
+//
+// The fields "message", "time" and "id" refer to the message, time and id of a result.
+// Words with a colon that don't start with a field name, e.g. 10:32:01 or http://host/path, are terms.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Fields that refer to the result rather than its labels
+const (
+	FieldMessage = "message"
+	FieldTime    = "time"
+	FieldId      = "id"
+)
+
+// Op is the operator of a match.
+type Op string
+
+const (
+	// OpMatch matches a label equal to the value or a message that contains the value
+	OpMatch Op = ":"
+	// OpWildcard matches a value with * wildcards
+	OpWildcard Op = ":*"
+	// OpRegex matches a regular expression
+	OpRegex Op = ":/"
+	OpGT    Op = ":>"
+	OpGTE   Op = ":>="
+	OpLT    Op = ":<"
+	OpLTE   Op = ":<="
+)
+
+// Node is a node of the syntax tree of a query.
+type Node interface {
+	String() string
+}
+
+// And matches when all of its nodes match.
+type And struct {
+	Nodes []Node
+}
+
+// Or matches when any of its nodes match.
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches when its node doesn't match.
+type Not struct {
+	Node Node
+}
+
+// Match matches a field against a value. An empty field is the message.
+type Match struct {
+	Field string
+	Op    Op
+	Value string
+
+	// re is the compiled regular expression of regex and wildcard matches
+	re *regexp.Regexp
+}
+
+func (t And) String() string { return "(" + joinNodes(t.Nodes, " AND ") + ")" }
+func (t Or) String() string  { return "(" + joinNodes(t.Nodes, " OR ") + ")" }
+func (t Not) String() string { return "NOT " + t.Node.String() }
+
+func (t Match) String() string {
+	value := t.Value
+	switch t.Op {
+	case OpRegex:
+		value = "/" + strings.ReplaceAll(value, "/", `\/`) + "/"
+	case OpMatch:
+		value = fmt.Sprintf("%q", value)
+	}
+
+	if t.Field == "" {
+		return value
+	}
+
+	switch t.Op {
+	case OpMatch, OpWildcard, OpRegex:
+		return t.Field + ":" + value
+	default:
+		return t.Field + string(t.Op) + value
+	}
+}
+
+// IsMessage reports whether the match is on the message.
+func (t Match) IsMessage() bool {
+	return t.Field == "" || t.Field == FieldMessage
+}
+
+func joinNodes(nodes []Node, sep string) string {
+	s := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		s = append(s, n.String())
+	}
+	return strings.Join(s, sep)
+}
+
+// Parse parses the query into its syntax tree.
+// An empty query returns a nil node, which matches everything.
+func Parse(query string) (Node, error) {
+	p := &parser{input: []rune(query)}
+	p.skipSpace()
+	if p.eof() {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", string(p.peek()))
+	}
+
+	return node, nil
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid query at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.input) }
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// keyword consumes the keyword if it's next in the input.
+func (p *parser) keyword(keyword string) bool {
+	if !p.peekKeyword(keyword) {
+		return false
+	}
+
+	p.pos += len(keyword)
+	return true
+}
+
+// peekKeyword reports whether the keyword is next in the input.
+// Keywords are upper case and followed by a space or a parenthesis.
+func (p *parser) peekKeyword(keyword string) bool {
+	p.skipSpace()
+	end := p.pos + len(keyword)
+	if end > len(p.input) || string(p.input[p.pos:end]) != keyword {
+		return false
+	}
+
+	return end == len(p.input) || unicode.IsSpace(p.input[end]) || p.input[end] == '('
+}
+
+func (p *parser) parseOr() (Node, error) {
+	var nodes []Node
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if !p.keyword("OR") {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		p.skipSpace()
+		// OR is handled by the caller
+		if p.eof() || p.peek() == ')' || p.peekKeyword("OR") {
+			break
+		}
+
+		explicit := p.keyword("AND")
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			if explicit {
+				return nil, p.errorf("expected a term after AND")
+			}
+			break
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, p.errorf("expected a term")
+	case 1:
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	p.skipSpace()
+	negate := p.keyword("NOT")
+	if !negate && p.peek() == '-' && p.pos+1 < len(p.input) && !unicode.IsSpace(p.input[p.pos+1]) {
+		p.pos++
+		negate = true
+	}
+
+	if !negate {
+		return p.parsePrimary()
+	}
+
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, p.errorf("expected a term after NOT")
+	}
+	return Not{Node: node}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	p.skipSpace()
+	switch p.peek() {
+	case 0:
+		return nil, nil
+
+	case '(':
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return node, nil
+
+	case '"':
+		value, err := p.parseQuoted('"')
+		if err != nil {
+			return nil, err
+		}
+		return Match{Op: OpMatch, Value: value}, nil
+
+	case '/':
+		return p.parseRegex("")
+	}
+
+	start := p.pos
+	for !p.eof() && !isDelimiter(p.peek()) && p.peek() != ':' {
+		p.pos++
+	}
+	word := string(p.input[start:p.pos])
+
+	if word == "" {
+		return nil, p.errorf("unexpected %q", string(p.peek()))
+	}
+
+	// Only identifiers are fields, the other words with a colon are terms, e.g. 10:32:01 or http://host/path
+	if p.peek() == ':' && (!isField(word) || strings.HasPrefix(string(p.input[p.pos:]), "://")) {
+		for !p.eof() && !isDelimiter(p.peek()) {
+			p.pos++
+		}
+		word = string(p.input[start:p.pos])
+	}
+	if p.peek() != ':' {
+		return wordMatch("", OpMatch, word), nil
+	}
+
+	// A field followed by its value
+	p.pos++
+	op := OpMatch
+	for _, candidate := range []Op{OpGTE, OpLTE, OpGT, OpLT} {
+		comparator := strings.TrimPrefix(string(candidate), ":")
+		if strings.HasPrefix(string(p.input[p.pos:]), comparator) {
+			op = candidate
+			p.pos += len(comparator)
+			break
+		}
+	}
+
+	switch p.peek() {
+	case '"':
+		value, err := p.parseQuoted('"')
+		if err != nil {
+			return nil, err
+		}
+		return Match{Field: word, Op: op, Value: value}, nil
+
+	case '/':
+		if op != OpMatch {
+			return nil, p.errorf("a regular expression cannot be compared")
+		}
+		return p.parseRegex(word)
+	}
+
+	start = p.pos
+	for !p.eof() && !isDelimiter(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("expected a value for the field %q", word)
+	}
+
+	return wordMatch(word, op, string(p.input[start:p.pos])), nil
+}
+
+func (p *parser) parseRegex(field string) (Node, error) {
+	expr, err := p.parseQuoted('/')
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, p.errorf("invalid regular expression %q: %v", expr, err)
+	}
+
+	return Match{Field: field, Op: OpRegex, Value: expr, re: re}, nil
+}
+
+// parseQuoted parses a value between the quotes.
+// The quote is escaped with a backslash.
+func (p *parser) parseQuoted(quote rune) (string, error) {
+	start := p.pos
+	p.pos++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '\\' && p.peek() == quote:
+			b.WriteRune(quote)
+			p.pos++
+		case c == '\\' && quote == '"' && p.peek() == '\\':
+			b.WriteRune('\\')
+			p.pos++
+		case c == quote:
+			return b.String(), nil
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	p.pos = start
+	return "", p.errorf("unterminated %c", quote)
+}
+
+func wordMatch(field string, op Op, value string) Match {
+	m := Match{Field: field, Op: op, Value: value}
+	if op == OpMatch && strings.Contains(value, "*") {
+		m.Op = OpWildcard
+		m.re = regexp.MustCompile(wildcardRegex(value, !m.IsMessage()))
+	}
+	return m
+}
+
+// isField reports whether the word is the name of a field: a letter or _ followed by
+// letters, digits and the _ . - @ of the names of nested and native fields.
+func isField(word string) bool {
+	for i, c := range word {
+		switch {
+		case unicode.IsLetter(c) || c == '_':
+		case i > 0 && (unicode.IsDigit(c) || c == '.' || c == '-' || c == '@'):
+		default:
+			return false
+		}
+	}
+	return word != ""
+}
+
+func isDelimiter(c rune) bool {
+	return unicode.IsSpace(c) || c == '(' || c == ')' || c == '"'
+}
@@ -0,0 +1,166 @@
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{query: "", want: "<nil>"},
+		{query: "error", want: `"error"`},
+		{query: `"connection refused"`, want: `"connection refused"`},
+		{query: `/timed? out/`, want: `/timed? out/`},
+		{query: "error timeout", want: `("error" AND "timeout")`},
+		{query: "error AND timeout OR panic", want: `(("error" AND "timeout") OR "panic")`},
+		{query: "pod:nginx-* -level:debug", want: `(pod:nginx-* AND NOT level:"debug")`},
+		{query: "NOT (namespace:default OR namespace:kube-system)", want: `NOT (namespace:"default" OR namespace:"kube-system")`},
+		{query: `status:>=500 time:<2023-03-09T12:29:11Z`, want: `(status:>=500 AND time:<2023-03-09T12:29:11Z)`},
+		{query: `msg:"a \"quoted\" value" path:/var\/log/`, want: `(msg:"a \"quoted\" value" AND path:/var\/log/)`},
+		{query: "GET http://host/api?id=1 10:32:01", want: `("GET" AND "http://host/api?id=1" AND "10:32:01")`},
+		{query: "url:http://host/api kubernetes.pod_name:api-1", want: `(url:"http://host/api" AND kubernetes.pod_name:"api-1")`},
+		{query: "error AND", wantErr: true},
+		{query: "(error", wantErr: true},
+		{query: `"unterminated`, wantErr: true},
+		{query: "level:/(/", wantErr: true},
+		{query: "status:>/5/", wantErr: true},
+		{query: "pod:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Parse(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			s := "<nil>"
+			if got != nil {
+				s = got.String()
+			}
+			if s != tt.want {
+				t.Errorf("Parse() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	result := logs.Result{
+		Time:    "2023-03-09T12:29:11Z",
+		Message: "GET /api returned 502: Connection refused",
+		Labels:  map[string]string{"pod": "nginx-7c9d", "level": "error", "status": "502"},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "", want: true},
+		{query: "connection", want: true},
+		{query: `"connection refused"`, want: true},
+		{query: "timeout", want: false},
+		{query: "pod:nginx-*", want: true},
+		{query: "pod:nginx", want: false},
+		{query: "level:ERROR", want: true},
+		{query: "level:/warn|error/", want: true},
+		{query: "missing:value", want: false},
+		{query: "status:>=500 status:<600", want: true},
+		{query: "status:>502", want: false},
+		{query: "time:>2023-03-09T00:00:00Z", want: true},
+		{query: "-level:error", want: false},
+		{query: "timeout OR refused", want: true},
+		{query: "/returned [0-9]+:/", want: true},
+		{query: "message:GET*refused", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := Matches(node, result); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToElasticsearch(t *testing.T) {
+	node, err := Parse(`error pod:nginx-* -status:>=500`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	fields := ElasticsearchFields{Message: "message", Timestamp: "@timestamp", Labels: logs.LabelMapping{"pod": "kubernetes.pod.name"}}
+	got, err := json.Marshal(ToElasticsearch(node, fields))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	want := `{"bool":{"filter":[{"match_phrase":{"message":"error"}},{"wildcard":{"kubernetes.pod.name":{"case_insensitive":true,"value":"nginx-*"}}},{"bool":{"must_not":[{"range":{"status":{"gte":"500"}}}]}}]}}`
+	if string(got) != want {
+		t.Errorf("ToElasticsearch() = %s, want %s", got, want)
+	}
+
+	body, err := AddToElasticsearchBody(`{"search_after":[1678364951828123456,"abc"],"query":{"match_all":{}}}`, `{"term":{"a":"b"}}`)
+	if err != nil {
+		t.Fatalf("AddToElasticsearchBody() error = %v", err)
+	}
+
+	want = `{"query":{"bool":{"filter":[{"match_all":{}},{"term":{"a":"b"}}]}},"search_after":[1678364951828123456,"abc"]}`
+	if body != want {
+		t.Errorf("AddToElasticsearchBody() = %s, want %s", body, want)
+	}
+}
+
+func TestToCloudWatch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "error", want: `@message like /(?i)error/`},
+		{query: `pod:nginx level:/warn|error/`, want: "(`kubernetes.pod_name` = \"nginx\" and `level` like /warn|error/)"},
+		{query: `status:>=500 OR NOT path:/api\/v1/`, want: "(`status` >= 500 or not `path` like /api\\/v1/)"},
+		{query: "pod:nginx-*", want: "`kubernetes.pod_name` like /(?i)^nginx-.*$/"},
+	}
+
+	mapping := logs.LabelMapping{"pod": "kubernetes.pod_name"}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := ToCloudWatch(node, mapping); got != tt.want {
+				t.Errorf("ToCloudWatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewElasticsearchTemplate(t *testing.T) {
+	q := &logs.SearchParams{Labels: map[string]string{"pod": "nginx-1", "app": "nginx"}}
+	data, err := NewElasticsearchTemplate(q, ElasticsearchFields{Labels: logs.LabelMapping{"pod": "kubernetes.pod.name"}})
+	if err != nil {
+		t.Fatalf("NewElasticsearchTemplate() error = %v", err)
+	}
+
+	if want := map[string]string{"pod": "nginx-1", "app": "nginx"}; !reflect.DeepEqual(data.Labels, want) {
+		t.Errorf("NewElasticsearchTemplate() labels = %v, want %v", data.Labels, want)
+	}
+	if want := map[string]string{"kubernetes.pod.name": "nginx-1", "app": "nginx"}; !reflect.DeepEqual(data.NativeLabels, want) {
+		t.Errorf("NewElasticsearchTemplate() native labels = %v, want %v", data.NativeLabels, want)
+	}
+}
@@ -1,16 +1,29 @@
 package pkg
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/flanksource/commons/logger"
 	"github.com/flanksource/commons/timer"
 
 	"github.com/flanksource/apm-hub/api"
 	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
 	"github.com/labstack/echo/v4"
 )
 
+// DefaultBackendTimeout is the timeout applied to backends
+// that do not configure their own.
+var DefaultBackendTimeout = 30 * time.Second
+
 // Search and collate logs
 func Search(c echo.Context) error {
 	cc := c.(*api.Context)
@@ -22,32 +35,468 @@ func Search(c echo.Context) error {
 	searchParams.SetDefaults()
 
 	timer := timer.NewTimer()
-	results := &logs.SearchResults{}
-	for i, backend := range logs.GlobalBackends {
-		matched, isAdditive := backend.API.MatchRoute(searchParams)
-		if !matched {
-			logger.Debugf("backend[%d] did not match any routes", i)
-			continue
+	results, err := SearchBackends(c.Request().Context(), logs.GlobalBackends, searchParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	logger.Infof("[%s] => %d results in %s", searchParams, results.Total, timer)
+
+	if searchParams.Strict && results.HasErrors() {
+		return cc.JSON(http.StatusBadGateway, logs.SearchResults{Backends: results.Backends})
+	}
+
+	return cc.JSON(http.StatusOK, *results)
+}
+
+type matchedBackend struct {
+	backend logs.SearchBackend
+	route   *logs.SearchRoute
+
+	// page is the backend's own page token for this search
+	page string
+}
+
+type backendResponse struct {
+	results  logs.SearchResults
+	err      error
+	duration time.Duration
+
+	// fallback is the backend that served the search after the matched backend failed
+	fallback string
+	// fallbackReason is the error of the matched backend that triggered the fallback
+	fallbackReason error
+}
+
+func (t backendResponse) status(m matchedBackend) logs.BackendStatus {
+	status := logs.BackendStatus{
+		Backend:  m.backend.Name,
+		Type:     m.backend.Type,
+		Duration: t.duration.Milliseconds(),
+		Total:    t.results.Total,
+	}
+	if t.err != nil {
+		status.Error = t.err.Error()
+	}
+	if t.fallback != "" {
+		status.Fallback = t.fallback
+		status.FallbackReason = t.fallbackReason.Error()
+	}
+
+	return status
+}
+
+// decodePage decodes the page token of the search, if any.
+func decodePage(q *logs.SearchParams) (*logs.PageToken, error) {
+	if q.Page == "" {
+		return nil, nil
+	}
+
+	return logs.DecodePageToken(q.Page)
+}
+
+// planSearch picks the backends the search runs on and
+// explains the routing decision made for every backend.
+func planSearch(backends []logs.SearchBackend, q *logs.SearchParams, page *logs.PageToken) ([]matchedBackend, []logs.BackendExplanation) {
+	var matched []matchedBackend
+	explanations := make([]logs.BackendExplanation, 0, len(backends))
+	for _, backend := range backends {
+		explanation := logs.BackendExplanation{
+			Backend:      backend.Name,
+			Type:         backend.Type,
+			Routes:       backend.Routes.Explain(q),
+			Capabilities: backend.API.Capabilities(),
 		}
 
-		searchResult, err := backend.API.Search(searchParams)
-		if err != nil {
-			logger.Errorf("error searching backend[%d]: %v", i, err)
+		switch route := backend.Routes.Find(q); {
+		case !q.SelectsBackend(backend.Name):
+			explanation.Reason = "backend not selected in the search"
+
+		case page != nil && !page.Has(backend.Name):
+			explanation.Reason = "backend has no more pages"
+
+		case route == nil:
+			explanation.Reason = "no route matched"
+
+		default:
+			explanation.Route = route
+			explanation.IsAdditive = route.IsAdditive
+			explanation.Run = true
+
+			m := matchedBackend{backend: backend, route: route}
+			if page != nil {
+				m.page = page.Cursors[backend.Name]
+			}
+			matched = append(matched, m)
+		}
+
+		if !explanation.Run {
+			logger.Debugf("backend[%s] skipped: %s", backend.Name, explanation.Reason)
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	// Backends are queried, and their additive routes take effect,
+	// in the order of the priority of the matched routes.
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].route.Priority > matched[j].route.Priority
+	})
+
+	return matched, explanations
+}
+
+// SearchBackends queries all the backends that match the search params concurrently
+// and collates their results.
+func SearchBackends(ctx context.Context, backends []logs.SearchBackend, q *logs.SearchParams) (*logs.SearchResults, error) {
+	if _, err := query.Parse(q.Query); err != nil {
+		return nil, err
+	}
+
+	page, err := decodePage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, _ := planSearch(backends, q, page)
+
+	responses := make([]backendResponse, len(matched))
+	var wg sync.WaitGroup
+	for i, m := range matched {
+		wg.Add(1)
+		go func(i int, m matchedBackend) {
+			defer wg.Done()
+			start := time.Now()
+			responses[i] = searchWithFallbacks(ctx, backends, m, q)
+			responses[i].duration = time.Since(start)
+		}(i, m)
+	}
+	wg.Wait()
+
+	statuses := make([]logs.BackendStatus, len(matched))
+	var collated []int
+	for i, m := range matched {
+		statuses[i] = responses[i].status(m)
+		if responses[i].err != nil {
+			logger.Errorf("error searching backend[%s]: %v", m.backend.Name, responses[i].err)
 			continue
 		}
-		results.Append(&searchResult)
 
 		// If the route is additive, all the previous search results are discarded
 		// and just the search result from this backend is returned exclusively.
-		if isAdditive {
-			logger.Infof("additive route matched. discarding previous results and exiting early")
-			results := &logs.SearchResults{}
-			results.Append(&searchResult)
+		if m.route.IsAdditive {
+			logger.Infof("additive route matched. discarding previous results")
+			for _, j := range collated {
+				statuses[j].Discarded = true
+			}
+			for j := i + 1; j < len(matched); j++ {
+				statuses[j] = responses[j].status(matched[j])
+				statuses[j].Discarded = true
+			}
+
+			collated = []int{i}
 			break
 		}
+
+		collated = append(collated, i)
 	}
 
-	logger.Infof("[%s] => %d results in %s", searchParams, results.Total, timer)
+	results, err := mergeSearchResults(q, matched, responses, statuses, collated)
+	if err != nil {
+		return nil, err
+	}
 
-	return cc.JSON(http.StatusOK, *results)
+	results.Backends = statuses
+	return results, nil
+}
+
+// mergeSearchResults merges the results of the collated backends in time order,
+// applies the global limits of the search params and
+// builds the page token to resume every backend that has more results.
+func mergeSearchResults(q *logs.SearchParams, matched []matchedBackend, responses []backendResponse, statuses []logs.BackendStatus, collated []int) (*logs.SearchResults, error) {
+	results := &logs.SearchResults{}
+	streams := make([][]logs.Result, 0, len(collated))
+	facets := make([]logs.Facets, 0, len(collated))
+	for _, i := range collated {
+		streams = append(streams, responses[i].results.Results)
+		facets = append(facets, responses[i].results.Facets)
+		results.Total += responses[i].results.Total
+	}
+	results.Facets = logs.MergeFacets(q.GetFacetLimit(), facets...)
+
+	merged := logs.MergeResults(q.Sort, q.Limit, q.LimitBytes, streams...)
+	results.Results = merged.Results
+
+	next := logs.NewPageToken()
+	for stream, i := range collated {
+		m, response := matched[i], responses[i].results
+		consumed := merged.Consumed[stream]
+		statuses[i].Results = consumed
+		statuses[i].Truncated = consumed < len(response.Results) || response.NextPage != ""
+
+		if responses[i].fallback != "" {
+			// The cursors of the fallback can't be handed to the matched backend,
+			// so results served by a fallback are not paginated.
+			logger.Debugf("backend[%s] was served by fallback backend[%s]. not paginating", m.backend.Name, responses[i].fallback)
+			continue
+		}
+
+		if cursor, ok := resumeCursor(m.page, response, consumed, merged.Cursors[stream]); ok {
+			next.Cursors[m.backend.Name] = cursor
+		} else if consumed < len(response.Results) {
+			logger.Debugf("backend[%s] cannot be resumed after %d results", m.backend.Name, consumed)
+		}
+	}
+
+	var err error
+	results.NextPage, err = next.Encode()
+	return results, err
+}
+
+// resumeCursor returns the cursor that resumes a stream of merged results, searched from the page,
+// after the results consumed of it, and whether the stream has more results to resume.
+func resumeCursor(page string, results logs.SearchResults, consumed int, cursor string) (string, bool) {
+	switch {
+	case consumed == len(results.Results):
+		// Every result was returned, so the own page token (if any) of the stream resumes it.
+		return results.NextPage, results.NextPage != ""
+
+	case consumed == 0:
+		// None of the results made it in, so the same page is requested again.
+		return page, true
+
+	case cursor != "":
+		return cursor, true
+	}
+
+	return "", false
+}
+
+// searchWithFallbacks searches the matched backend and, if it fails,
+// tries the fallbacks of the matched route in order until one of them succeeds.
+func searchWithFallbacks(ctx context.Context, backends []logs.SearchBackend, m matchedBackend, q *logs.SearchParams) backendResponse {
+	backendParams := q.Clone()
+	backendParams.Page = m.page
+
+	var response backendResponse
+	response.results, response.err = searchRoute(ctx, m.backend, m.route, backendParams)
+	if response.err == nil {
+		return response
+	}
+
+	for _, name := range m.route.Fallbacks {
+		fallback := findBackend(backends, name)
+		if fallback == nil {
+			logger.Warnf("fallback backend[%s] of backend[%s] not found", name, m.backend.Name)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		logger.Infof("backend[%s] failed (%v). falling back to backend[%s]", m.backend.Name, response.err, name)
+
+		// The page token belongs to the matched backends,
+		// so the fallback always starts from the first page.
+		fallbackParams := q.Clone()
+		fallbackParams.Page = ""
+		results, err := searchBackend(ctx, *fallback, fallbackParams)
+		if err != nil {
+			logger.Errorf("error searching fallback backend[%s]: %v", name, err)
+			continue
+		}
+
+		return backendResponse{
+			results:        results,
+			fallback:       name,
+			fallbackReason: response.err,
+		}
+	}
+
+	return response
+}
+
+// searchRoute runs the search against the backend of a route,
+// after rewriting it with the route's rewrite.
+//
+// A rewrite that fans the search out runs every search concurrently and merges
+// their results. Fanned out searches fail as a whole when any one of them fails,
+// and are paginated with a page token that holds the cursor of every search,
+// keyed by its index, that has more results.
+func searchRoute(ctx context.Context, backend logs.SearchBackend, route *logs.SearchRoute, q *logs.SearchParams) (logs.SearchResults, error) {
+	queries, err := rewriteSearch(route, q)
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+
+	if len(queries) == 1 {
+		return searchBackend(ctx, backend, &queries[0])
+	}
+
+	paged, err := pageFannedOut(q.Page, queries)
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+
+	responses := make([]backendResponse, len(queries))
+	var wg sync.WaitGroup
+	for _, i := range paged {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i].results, responses[i].err = searchBackend(ctx, backend, &queries[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var results logs.SearchResults
+	streams := make([][]logs.Result, 0, len(responses))
+	facets := make([]logs.Facets, 0, len(responses))
+	for i, response := range responses {
+		if response.err != nil {
+			return results, fmt.Errorf("error searching [%s]: %w", strings.TrimSpace(queries[i].String()), response.err)
+		}
+
+		results.Total += response.results.Total
+		streams = append(streams, response.results.Results)
+		facets = append(facets, response.results.Facets)
+	}
+	results.Facets = logs.MergeFacets(q.GetFacetLimit(), facets...)
+
+	merged := logs.MergeResults(q.Sort, q.Limit, q.LimitBytes, streams...)
+	results.Results = merged.Results
+
+	next := logs.NewPageToken()
+	for _, i := range paged {
+		if cursor, ok := resumeCursor(queries[i].Page, responses[i].results, merged.Consumed[i], merged.Cursors[i]); ok {
+			next.Cursors[strconv.Itoa(i)] = cursor
+		}
+	}
+
+	results.NextPage, err = next.Encode()
+	return results, err
+}
+
+// pageFannedOut sets the cursors of the page token of fanned out searches on the searches
+// and returns the indexes of the searches that have more results: all of them on the first page.
+func pageFannedOut(token string, queries []logs.SearchParams) ([]int, error) {
+	var page *logs.PageToken
+	if token != "" {
+		var err error
+		if page, err = logs.DecodePageToken(token); err != nil {
+			return nil, err
+		}
+	}
+
+	var paged []int
+	for i := range queries {
+		queries[i].Page = ""
+		if page != nil {
+			if !page.Has(strconv.Itoa(i)) {
+				continue
+			}
+			queries[i].Page = page.Cursors[strconv.Itoa(i)]
+		}
+		paged = append(paged, i)
+	}
+
+	return paged, nil
+}
+
+// rewriteSearch maps the search with the rewrite of the route,
+// after removing the labels the route matched.
+// Without a rewrite the search is returned as is.
+func rewriteSearch(route *logs.SearchRoute, q *logs.SearchParams) ([]logs.SearchParams, error) {
+	q = withoutRouteLabels(route, q)
+	if route == nil || route.Rewrite == nil {
+		return []logs.SearchParams{*q}, nil
+	}
+
+	var mapper logs.SearchMapper = route.Rewrite
+	queries, err := mapper.MapSearchParams(q)
+	if err != nil {
+		return nil, fmt.Errorf("error rewriting search: %w", err)
+	}
+
+	return queries, nil
+}
+
+func findBackend(backends []logs.SearchBackend, name string) *logs.SearchBackend {
+	for i := range backends {
+		if backends[i].Name == name {
+			return &backends[i]
+		}
+	}
+
+	return nil
+}
+
+// withoutBackendLabel returns the search without the backend label, which is matched
+// when the backends of the search are picked and attached to the results after the search.
+func withoutBackendLabel(q *logs.SearchParams) *logs.SearchParams {
+	if _, ok := q.Labels[logs.LabelBackend]; !ok {
+		return q
+	}
+
+	q = q.Clone()
+	delete(q.Labels, logs.LabelBackend)
+	return q
+}
+
+// withoutRouteLabels returns the search without the labels of the route. They pick the backend,
+// like the backend label, and aren't labels of its results, which carry the labels of the backend instead.
+func withoutRouteLabels(route *logs.SearchRoute, q *logs.SearchParams) *logs.SearchParams {
+	if route == nil || len(route.Labels) == 0 {
+		return q
+	}
+
+	q = q.Clone()
+	for k := range route.Labels {
+		delete(q.Labels, k)
+	}
+	return q
+}
+
+// searchBackend runs the search against a single backend
+// bounded by the backend's timeout.
+//
+// The messages of the results are parsed into labels, when the backend parses them,
+// and the parts of the search the backend can't apply itself are applied to the results.
+func searchBackend(ctx context.Context, backend logs.SearchBackend, q *logs.SearchParams) (logs.SearchResults, error) {
+	caps := backend.API.Capabilities()
+	backendParams, offset, err := prepareSearch(q, caps)
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+
+	timeout := backend.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBackendTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results, err := backend.API.Search(ctx, backendParams)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return results, fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		return results, err
+	}
+
+	if backend.Parse != nil && !caps.Parse {
+		for i := range results.Results {
+			results.Results[i] = backend.Parse.Parse(results.Results[i])
+		}
+	}
+
+	if results, err = postFilter(withoutBackendLabel(q), caps, offset, results); err != nil {
+		return results, err
+	}
+
+	for i := range results.Results {
+		results.Results[i] = results.Results[i].WithLabel(logs.LabelBackend, backend.Name)
+	}
+
+	return results, nil
 }
@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// failingSearch is a backend whose searches fail.
+type failingSearch struct{}
+
+func (t failingSearch) Capabilities() logs.Capabilities { return logs.Capabilities{} }
+
+func (t failingSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	return logs.SearchResults{}, fmt.Errorf("unavailable")
+}
+
+// firstPageSearch is a backend that only serves the first page of a search.
+type firstPageSearch struct {
+	staticSearch
+}
+
+func (t firstPageSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	if q.Page != "" {
+		return logs.SearchResults{}, fmt.Errorf("invalid page token")
+	}
+	return t.staticSearch.Search(ctx, q)
+}
+
+func TestSearchWithFallbacks(t *testing.T) {
+	route := logs.SearchRoute{Type: "KubernetesPod", Fallbacks: []string{"archive"}}
+	backends := []logs.SearchBackend{
+		{Name: "pods", Routes: logs.Routes{route}, API: failingSearch{}},
+		{Name: "archive", API: firstPageSearch{staticSearch{results: []logs.Result{{Time: "2023-03-09T12:00:00Z", Message: "archived"}}}}},
+	}
+
+	page := logs.NewPageToken()
+	page.Cursors["pods"] = "2"
+	token, err := page.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Later pages of the search are served by the fallback from its first page
+	m := matchedBackend{backend: backends[0], route: &route, page: "2"}
+	response := searchWithFallbacks(context.Background(), backends, m, &logs.SearchParams{Type: "KubernetesPod", Page: token})
+	if response.err != nil {
+		t.Fatalf("searchWithFallbacks() error = %v", response.err)
+	}
+	if response.fallback != "archive" || len(response.results.Results) != 1 {
+		t.Errorf("searchWithFallbacks() = %+v, want the results of the fallback", response)
+	}
+}
+
+func TestSearchRouteFanOutPages(t *testing.T) {
+	route := logs.SearchRoute{Type: "KubernetesPod", Rewrite: &logs.SearchRewrite{
+		FanOut: &logs.SearchFanOut{Label: "namespace", Values: []string{"default", "kube-system"}},
+	}}
+	backend := logs.SearchBackend{Name: "pods", Routes: logs.Routes{route}, API: staticSearch{results: []logs.Result{
+		{Time: "2023-03-09T12:00:00Z", Message: "1", Labels: map[string]string{"namespace": "default"}},
+		{Time: "2023-03-09T12:01:00Z", Message: "2", Labels: map[string]string{"namespace": "kube-system"}},
+		{Time: "2023-03-09T12:02:00Z", Message: "3", Labels: map[string]string{"namespace": "default"}},
+		{Time: "2023-03-09T12:03:00Z", Message: "4", Labels: map[string]string{"namespace": "default"}},
+		{Time: "2023-03-09T12:04:00Z", Message: "5", Labels: map[string]string{"namespace": "kube-system"}},
+		{Time: "2023-03-09T12:05:00Z", Message: "other", Labels: map[string]string{"namespace": "other"}},
+	}}}
+
+	q := &logs.SearchParams{Type: "KubernetesPod", Limit: 2, Sort: logs.SortAscending}
+	var got []string
+	for i := 0; i < 10; i++ {
+		res, err := searchRoute(context.Background(), backend, &route, q)
+		if err != nil {
+			t.Fatalf("searchRoute() error = %v", err)
+		}
+		for _, r := range res.Results {
+			got = append(got, r.Message)
+		}
+		if res.NextPage == "" {
+			break
+		}
+		q.Page = res.NextPage
+	}
+
+	if want := []string{"1", "2", "3", "4", "5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("searchRoute() pages = %v, want %v", got, want)
+	}
+}
+
+func TestSearchBackendsRouteLabels(t *testing.T) {
+	// The routes of samples/config-file.yaml: the type of the route isn't the type of the results
+	results := []logs.Result{{Time: "2023-03-09T12:00:00Z", Message: "GET /", Labels: map[string]string{"name": "acmehost", "type": "Nginx"}}}
+	backends := []logs.SearchBackend{
+		{Name: "nginx-access", Routes: logs.Routes{{IdPrefix: "nginx-", Labels: map[string]string{"type": "access"}}}, API: staticSearch{results: results}},
+		{Name: "nginx-error", Routes: logs.Routes{{IdPrefix: "nginx-", Labels: map[string]string{"type": "error"}}}, API: staticSearch{results: results}},
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{name: "route", labels: map[string]string{"type": "access"}, want: []string{"nginx-access"}},
+		{name: "route and result", labels: map[string]string{"type": "error", "name": "acmehost"}, want: []string{"nginx-error"}},
+		{name: "route and missing", labels: map[string]string{"type": "error", "name": "other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := SearchBackends(context.Background(), backends, &logs.SearchParams{Id: "nginx-1", Labels: tt.labels})
+			if err != nil {
+				t.Fatalf("SearchBackends() error = %v", err)
+			}
+
+			var got []string
+			for _, r := range res.Results {
+				got = append(got, r.Labels[logs.LabelBackend])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchBackends() = %v, want the results of %v", got, tt.want)
+			}
+		})
+	}
+}
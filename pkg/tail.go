@@ -0,0 +1,334 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/query"
+	"github.com/flanksource/commons/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// TailPollInterval is how often the backends that can't stream
+// their logs are searched for new results.
+var TailPollInterval = 5 * time.Second
+
+// TailPollFailures is the number of polls in a row that can fail
+// before the tail of the polled backend fails.
+var TailPollFailures = 3
+
+// TailHeartbeatInterval is how often a heartbeat is sent
+// to keep an idle stream open through proxies.
+var TailHeartbeatInterval = 15 * time.Second
+
+// tailBufferSize is the number of results buffered for a slow client.
+// Once the buffer is full the backends are blocked until the client catches up.
+const tailBufferSize = 100
+
+// Tail streams the results of a search, as server-sent events,
+// as they are written until the client disconnects.
+//
+// Every result is sent as a "result" event and a backend that fails is reported
+// with an "error" event. An "end" event is sent once every backend stopped.
+func Tail(c echo.Context) error {
+	searchParams := new(logs.SearchParams)
+	if err := c.Bind(searchParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	searchParams.SetDefaults()
+
+	ctx := c.Request().Context()
+	events, err := TailBackends(ctx, logs.GlobalBackends, searchParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	heartbeat := time.NewTicker(TailHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	logger.Infof("[%s] tailing", searchParams)
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			logger.Infof("[%s] tail closed by the client", searchParams)
+			return nil
+
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+
+		case event, ok := <-events:
+			if !ok {
+				_, _ = fmt.Fprint(w, "event: end\ndata: {}\n\n")
+				w.Flush()
+				return nil
+			}
+			err = writeTailEvent(w, event)
+		}
+
+		if err != nil {
+			logger.Debugf("[%s] error writing to the tail stream: %v", searchParams, err)
+			return nil
+		}
+		w.Flush()
+	}
+}
+
+func writeTailEvent(w *echo.Response, event logs.TailEvent) error {
+	name, data := "result", any(event.Result)
+	if event.Result == nil {
+		name, data = "error", event
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body)
+	return err
+}
+
+// TailBackends tails every backend that matches the search params
+// and sends their results to the returned channel as they are written.
+//
+// The channel is closed once every backend stopped, which only happens
+// on its own when the backends fail. Cancel the context to stop tailing.
+func TailBackends(ctx context.Context, backends []logs.SearchBackend, q *logs.SearchParams) (<-chan logs.TailEvent, error) {
+	if q.Page != "" {
+		return nil, fmt.Errorf("a tail cannot start from a page")
+	}
+	if _, err := query.Parse(q.Query); err != nil {
+		return nil, err
+	}
+
+	matched, _ := planSearch(backends, q, nil)
+
+	// The first additive route replaces every other backend, as it does for a search
+	for _, m := range matched {
+		if m.route.IsAdditive {
+			matched = []matchedBackend{m}
+			break
+		}
+	}
+
+	events := make(chan logs.TailEvent, tailBufferSize)
+	var wg sync.WaitGroup
+	for _, m := range matched {
+		wg.Add(1)
+		go func(m matchedBackend) {
+			defer wg.Done()
+			tailBackend(ctx, m, q.Clone(), events)
+		}(m)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// tailBackend forwards the results of the backend to the events
+// and reports the error that stopped it, if any.
+func tailBackend(ctx context.Context, m matchedBackend, q *logs.SearchParams, events chan<- logs.TailEvent) {
+	results := make(chan logs.Result)
+	done := make(chan error, 1)
+	go func() {
+		done <- tailRoute(ctx, m, q, results)
+		close(results)
+	}()
+
+	for r := range results {
+		result := r.WithLabel(logs.LabelBackend, m.backend.Name)
+		select {
+		case events <- logs.TailEvent{Result: &result}:
+		case <-ctx.Done():
+		}
+	}
+
+	if err := <-done; err != nil && ctx.Err() == nil {
+		logger.Errorf("error tailing backend[%s]: %v", m.backend.Name, err)
+		select {
+		case events <- logs.TailEvent{Backend: m.backend.Name, Error: err.Error()}:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// tailRoute tails every search the route's rewrite maps the search into.
+// Backends that implement logs.Tailer stream their results,
+// the others are polled.
+func tailRoute(ctx context.Context, m matchedBackend, q *logs.SearchParams, results chan<- logs.Result) error {
+	queries, err := rewriteSearch(m.route, withoutBackendLabel(q))
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if tailer, ok := m.backend.API.(logs.Tailer); ok {
+				// Backends that parse their results also parse the results of their tails
+				parse := m.backend.Parse
+				if m.backend.API.Capabilities().Parse {
+					parse = nil
+				}
+				errs[i] = tailParsed(ctx, tailer, parse, &queries[i], results)
+			} else {
+				errs[i] = pollSearch(ctx, m.backend, &queries[i], results)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// tailParsed streams the results of the tailer and parses their messages.
+//
+// The query is evaluated on the parsed results, rather than by the tailer,
+// so it can match the labels parsed out of the messages.
+func tailParsed(ctx context.Context, tailer logs.Tailer, parse *logs.ParseConfig, q *logs.SearchParams, results chan<- logs.Result) error {
+	if parse == nil {
+		return tailer.Tail(ctx, q, results)
+	}
+
+	node, err := query.Parse(q.Query)
+	if err != nil {
+		return err
+	}
+
+	unparsed := make(chan logs.Result)
+	done := make(chan error, 1)
+	tailParams := q.Clone()
+	tailParams.Query = ""
+	go func() {
+		done <- tailer.Tail(ctx, tailParams, unparsed)
+		close(unparsed)
+	}()
+
+	for r := range unparsed {
+		result := parse.Parse(r)
+		if !query.Matches(node, result) {
+			continue
+		}
+
+		select {
+		case results <- result:
+		case <-ctx.Done():
+		}
+	}
+
+	return <-done
+}
+
+// pollSearch tails a backend by repeating the search every TailPollInterval
+// with a start that moves forward to the newest result seen.
+// Every poll pages through the results, oldest first, so none are lost to the limit
+// of the search, and results that were already sent are skipped.
+//
+// A failed poll is retried on the next tick. The tail fails once TailPollFailures polls
+// failed in a row, so a broken backend is reported rather than mistaken for a quiet one.
+func pollSearch(ctx context.Context, backend logs.SearchBackend, q *logs.SearchParams, results chan<- logs.Result) error {
+	// The results at the start of the next search are returned again,
+	// so the results of the last second are remembered.
+	seen := make(map[string]time.Time)
+	ticker := time.NewTicker(TailPollInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		latest := time.Time{}
+		if start := q.GetStart(); start != nil {
+			latest = *start
+		}
+
+		pageParams := q.Clone()
+		pageParams.Sort = logs.SortAscending
+		for {
+			response, err := searchBackend(ctx, backend, pageParams)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if failures++; failures >= TailPollFailures {
+					return fmt.Errorf("%d polls failed in a row: %w", failures, err)
+				}
+				logger.Warnf("error polling backend[%s]: %v", backend.Name, err)
+				break
+			}
+			failures = 0
+
+			ordered := logs.MergeResults(logs.SortAscending, 0, 0, response.Results)
+			for _, result := range ordered.Results {
+				key := resultKey(result)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+
+				// Results without a time don't move the start forward
+				t, ok := result.GetTime()
+				if !ok {
+					t = time.Now()
+				} else if t.After(latest) {
+					latest = t
+				}
+				seen[key] = t
+
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+			if response.NextPage == "" {
+				break
+			}
+			pageParams.Page = response.NextPage
+		}
+
+		if !latest.IsZero() {
+			q.SetStart(latest)
+		}
+		for key, t := range seen {
+			if t.Before(latest.Add(-time.Second)) {
+				delete(seen, key)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// resultKey identifies a result across searches.
+func resultKey(r logs.Result) string {
+	if r.Id != "" {
+		return r.Id
+	}
+
+	return r.Time + "\x00" + r.Message
+}
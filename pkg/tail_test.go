@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestPollSearch(t *testing.T) {
+	base := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	var all []logs.Result
+	var want []string
+	for i := 0; i < 5; i++ {
+		message := string(rune('a' + i))
+		all = append(all, logs.Result{Time: base.Add(time.Duration(i) * time.Second).Format(time.RFC3339), Message: message})
+		want = append(want, message)
+	}
+	backend := logs.SearchBackend{Name: "static", API: staticSearch{results: all}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := make(chan logs.Result)
+	q := &logs.SearchParams{Limit: 2, Start: base.Add(-time.Second).Format(time.RFC3339)}
+	go pollSearch(ctx, backend, q, results)
+
+	// Every result of a poll is sent, even past the limit of the search
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case r := <-results:
+			got = append(got, r.Message)
+		case <-ctx.Done():
+			t.Fatalf("pollSearch() sent %v, want %v", got, want)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pollSearch() = %v, want %v", got, want)
+	}
+}
+
+func TestPollSearchFailures(t *testing.T) {
+	interval := TailPollInterval
+	TailPollInterval = 10 * time.Millisecond
+	defer func() { TailPollInterval = interval }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	backend := logs.SearchBackend{Name: "broken", API: failingSearch{}}
+	err := pollSearch(ctx, backend, &logs.SearchParams{}, make(chan logs.Result))
+	if err == nil || ctx.Err() != nil {
+		t.Errorf("pollSearch() error = %v, want the error of the failed polls", err)
+	}
+}